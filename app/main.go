@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"net/http"
@@ -10,17 +15,34 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nanassito/medicine/pkg/auth"
 	"github.com/nanassito/medicine/pkg/handlers"
+	"github.com/nanassito/medicine/pkg/mqtt"
+	"github.com/nanassito/medicine/pkg/reminders"
+	"github.com/nanassito/medicine/pkg/store"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
 var (
-	creds = flag.String("creds", "../creds.json", "Google credential file.")
-	port  = flag.Int("port", 80, "Port to listen on.")
+	creds        = flag.String("creds", "../creds.json", "Google credential file.")
+	sheetsConfig = flag.String("sheets-config", "", "JSON file with the spreadsheet ID and the range of each tab.")
+	sheetID      = flag.String("sheet-id", "", "ID of the spreadsheet, overrides the one from -sheets-config.")
+	sqlite       = flag.String("sqlite", "", "SQLite database to use instead of the Google Sheet, -creds is ignored when set.")
+	port         = flag.Int("port", 80, "Port to listen on.")
+	refresh      = flag.Duration("refresh", time.Minute, "How often to refresh the cached data, 0 disables the cache.")
+	mqttBroker   = flag.String("mqtt", "", "MQTT broker to publish the doses to, eg. tcp://localhost:1883. Disabled when empty.")
+	mqttPrefix   = flag.String("mqtt-prefix", "medicine", "Prefix of the MQTT topics.")
+	weightMaxAge = flag.Duration("weight-max-age", 90*24*time.Hour, "Warn when the last weight measurement of someone is older than this.")
+	remindersCfg = flag.String("reminders", "", "JSON file with the person and medicine pairs to send a reminder for when the next dose is allowed.")
+	authCfg      = flag.String("auth", "", "JSON file with the accounts and roles of the users, anyone who can reach the app may use it when empty.")
+	households   = flag.String("households", "", "JSON file listing the households to serve, each with its own data. Requires -auth, users see the household of their account.")
+	timeZone     = flag.String("tz", "", "Time zone of the household, eg. Europe/Paris. The one of the machine when empty, or with a Google Sheet the time_zone of the -sheets-config and UTC without one. With a Google Sheet the times typed without an offset are in it, which needs time_zone_since in the -sheets-config.")
+	hashPassword = flag.Bool("hash-password", false, "Read a password on stdin and print its hash for the -auth config, then exit.")
 )
 
 func mustGetCreds() []byte {
@@ -42,8 +64,6 @@ func mustGetCreds() []byte {
 }
 
 func mustGoogleService() *sheets.Service {
-	flag.Parse()
-
 	scopes := []string{
 		"https://www.googleapis.com/auth/spreadsheets",
 	}
@@ -60,16 +80,173 @@ func mustGoogleService() *sheets.Service {
 	return srv
 }
 
-func main() {
-	r := mux.NewRouter()
-	handler, err := handlers.NewMedicineHandler(mustGoogleService())
+// household is an entry of the -households config, the fields mirror the flags of the same name.
+type household struct {
+	Name         string `json:"name"`
+	SheetsConfig string `json:"sheets_config"`
+	SheetID      string `json:"sheet_id"`
+	SQLite       string `json:"sqlite"`
+	Reminders    string `json:"reminders"`
+	TimeZone     string `json:"time_zone"` // -tz
+}
+
+func mustLoadHouseholds(path string) []household {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("unable to read %s: %v", path, err)
+	}
+	var cfg struct {
+		Households []household `json:"households"`
+	}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		log.Fatalf("unable to parse %s: %v", path, err)
+	}
+	return cfg.Households
+}
+
+func mustLocation(name string) *time.Location {
+	if name == "" {
+		return time.Local
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		log.Fatalf("unable to load the time zone %s: %v", name, err)
+	}
+	return location
+}
+
+// mustStore opens the store of a household along with its time zone, which the pages must show the times in.
+func mustStore(h household) (store.Store, *time.Location) {
+	if h.SQLite != "" {
+		st, err := store.NewSQLite(h.SQLite)
+		if err != nil {
+			log.Fatal("unable to open the database:", err)
+		}
+		st.Location = mustLocation(h.TimeZone)
+		return st, st.Location
+	}
+	cfg := store.DefaultSheetsConfig
+	if h.SheetsConfig != "" {
+		var err error
+		if cfg, err = store.LoadSheetsConfig(h.SheetsConfig); err != nil {
+			log.Fatal("unable to load the sheets config:", err)
+		}
+	}
+	if h.SheetID != "" {
+		cfg.DocID = h.SheetID
+	}
+	if h.TimeZone != "" {
+		cfg.TimeZone = h.TimeZone
+	}
+	st, err := store.NewSheets(mustGoogleService(), cfg)
+	if err != nil {
+		log.Fatal("unable to open the spreadsheet:", err)
+	}
+	return st, st.Location
+}
+
+// mustHandler wires the store of a household with the cache, MQTT and reminders.
+func mustHandler(h household, publisher mqtt.Publisher) *handlers.MedicineHandler {
+	st, location := mustStore(h)
+	if *refresh > 0 {
+		cached := store.NewCached(st, *refresh)
+		go cached.Run(context.Background())
+		st = cached
+	}
+	prefix := *mqttPrefix
+	if h.Name != "" {
+		prefix += "/" + mqtt.TopicLevel(h.Name)
+	}
+	if publisher != nil {
+		published := mqtt.NewStore(st, publisher, prefix)
+		go published.Run(context.Background(), time.Minute)
+		st = published
+	}
+	if h.Reminders != "" {
+		cfg, err := reminders.LoadConfig(h.Reminders)
+		if err != nil {
+			log.Fatal("unable to load the reminders config:", err)
+		}
+		notifiers := []reminders.Notifier{reminders.Log{}}
+		if cfg.Webhook != "" {
+			notifiers = append(notifiers, reminders.Webhook{URL: cfg.Webhook, Client: &http.Client{Timeout: 10 * time.Second}})
+		}
+		if publisher != nil {
+			notifiers = append(notifiers, reminders.MQTT{Publisher: publisher, Prefix: prefix})
+		}
+		go reminders.NewScheduler(st, cfg.Pairs, time.Minute, notifiers...).Run(context.Background())
+	}
+
+	handler, err := handlers.NewMedicineHandler(st)
 	if err != nil {
 		log.Fatal("unable to start the service:", err)
 	}
-	slog.Info("config", "handler", handler)
-	handler.Register(r)
+	handler.WeightMaxAge = *weightMaxAge
+	handler.Location = location
+	slog.Info("config", "household", h.Name, "handler", handler)
+	return handler
+}
+
+func main() {
+	flag.Parse()
+	if *hashPassword {
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			log.Fatal("unable to read the password:", err)
+		}
+		hash, err := auth.HashPassword(strings.TrimRight(password, "\r\n"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(hash)
+		return
+	}
+
+	var publisher mqtt.Publisher
+	if *mqttBroker != "" {
+		var err error
+		if publisher, err = mqtt.Connect(*mqttBroker, "medicine"); err != nil {
+			log.Fatal("unable to connect to the MQTT broker:", err)
+		}
+	}
+
+	r := mux.NewRouter()
+	var root http.Handler = r
+	var users []auth.User
+	if *authCfg != "" {
+		cfg, err := auth.LoadConfig(*authCfg)
+		if err != nil {
+			log.Fatal("unable to load the auth config:", err)
+		}
+		users = cfg.Users
+		authenticator, err := auth.NewAuthenticator(cfg)
+		if err != nil {
+			log.Fatal("unable to start the authentication:", err)
+		}
+		authenticator.Register(r)
+		root = authenticator.Middleware(r)
+	}
+	if *households != "" {
+		if *authCfg == "" {
+			log.Fatal("-households requires -auth to know the household of each user")
+		}
+		served := handlers.NewHouseholds()
+		for _, h := range mustLoadHouseholds(*households) {
+			h.TimeZone = cmp.Or(h.TimeZone, *timeZone)
+			if err := served.Add(h.Name, mustHandler(h, publisher)); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := served.CheckUsers(users); err != nil {
+			log.Fatal(err)
+		}
+		r.PathPrefix("/").Handler(served)
+	} else {
+		h := household{SheetsConfig: *sheetsConfig, SheetID: *sheetID, SQLite: *sqlite, Reminders: *remindersCfg, TimeZone: *timeZone}
+		mustHandler(h, publisher).Register(r)
+	}
 
-	http.Handle("/", r)
+	http.Handle("/", root)
 	addr := strconv.Itoa(*port)
 	slog.Info("listening", "addr", "http://localhost:"+addr)
 	if err := http.ListenAndServe(":"+addr, nil); err != nil {
@@ -0,0 +1,271 @@
+// Package auth identifies who is using the app, either with a local account or from the header set
+// by a trusted reverse proxy, and keeps the viewers from changing anything.
+package auth
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/nanassito/medicine/pkg/templates"
+)
+
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"    // Can only look.
+	RoleCaregiver Role = "caregiver" // Can also log and delete doses, weights, etc.
+)
+
+type User struct {
+	Name     string `json:"name"`
+	Password string `json:"password"` // bcrypt hash, see HashPassword. Users without one can only come through the proxy.
+	Role     Role   `json:"role"`
+	// Household is the data they see when the app serves several households, see handlers.Households.
+	Household string `json:"household,omitempty"`
+}
+
+// CanEdit tells whether the user may change anything.
+func (u User) CanEdit() bool {
+	return u.Role == RoleCaregiver
+}
+
+type Config struct {
+	Users []User `json:"users"`
+	// Header is set by a trusted reverse proxy to the name of the user it authenticated, eg. X-Forwarded-User.
+	// Only set it when the app can't be reached without going through the proxy.
+	Header string `json:"header"`
+	// HeaderRole is the role of the users from the header that aren't listed, viewer when empty.
+	// They don't belong to any household.
+	HeaderRole Role `json:"header_role"`
+	// Secret signs the session cookies, they don't survive a restart when it's empty.
+	Secret string `json:"secret"`
+}
+
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return cfg, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	for _, user := range cfg.Users {
+		if user.Role != RoleViewer && user.Role != RoleCaregiver {
+			return cfg, fmt.Errorf("unknown role %q for %s, want %s or %s", user.Role, user.Name, RoleViewer, RoleCaregiver)
+		}
+	}
+	return cfg, nil
+}
+
+// HashPassword returns the hash to put in the config of a user.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("unable to hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+const (
+	sessionCookie   = "session"
+	sessionDuration = 30 * 24 * time.Hour
+)
+
+type Authenticator struct {
+	Config Config
+
+	secret []byte
+	dummy  []byte // Hash to compare the password of unknown users to.
+}
+
+func NewAuthenticator(cfg Config) (*Authenticator, error) {
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		secret = []byte(rand.Text())
+	}
+	dummy, err := bcrypt.GenerateFromPassword([]byte(rand.Text()), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("unable to hash password: %v", err)
+	}
+	return &Authenticator{Config: cfg, secret: secret, dummy: dummy}, nil
+}
+
+func (a *Authenticator) user(name string) (User, bool) {
+	for _, user := range a.Config.Users {
+		if user.Name == name {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// login checks the password of a local account.
+func (a *Authenticator) login(name, password string) (User, bool) {
+	user, ok := a.user(name)
+	if !ok || user.Password == "" {
+		// Compare anyway so that the response time doesn't tell which accounts exist.
+		bcrypt.CompareHashAndPassword(a.dummy, []byte(password))
+		return User{}, false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return User{}, false
+	}
+	return user, true
+}
+
+func (a *Authenticator) sign(value string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// session is the signed `<name>|<expiry>` of a user, the name is base64 encoded as it may contain anything.
+func (a *Authenticator) session(user User, now time.Time) string {
+	value := base64.RawURLEncoding.EncodeToString([]byte(user.Name)) + "|" + strconv.FormatInt(now.Add(sessionDuration).Unix(), 10)
+	return value + "|" + a.sign(value)
+}
+
+func (a *Authenticator) fromSession(cookie string, now time.Time) (User, bool) {
+	i := strings.LastIndex(cookie, "|")
+	if i < 0 || !hmac.Equal([]byte(cookie[i+1:]), []byte(a.sign(cookie[:i]))) {
+		return User{}, false
+	}
+	encodedName, expiry, _ := strings.Cut(cookie[:i], "|")
+	if unix, err := strconv.ParseInt(expiry, 10, 64); err != nil || now.After(time.Unix(unix, 0)) {
+		return User{}, false
+	}
+	name, err := base64.RawURLEncoding.DecodeString(encodedName)
+	if err != nil {
+		return User{}, false
+	}
+	// The account may have been removed or its role changed since.
+	return a.user(string(name))
+}
+
+// Identify finds out who made a request, from the proxy header, a session cookie or basic auth for the API.
+func (a *Authenticator) Identify(r *http.Request) (User, bool) {
+	if a.Config.Header != "" {
+		if name := r.Header.Get(a.Config.Header); name != "" {
+			if user, ok := a.user(name); ok {
+				return user, true
+			}
+			return User{Name: name, Role: cmp.Or(a.Config.HeaderRole, RoleViewer)}, true
+		}
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if user, ok := a.fromSession(cookie.Value, time.Now()); ok {
+			return user, true
+		}
+	}
+	if name, password, ok := r.BasicAuth(); ok {
+		return a.login(name, password)
+	}
+	return User{}, false
+}
+
+type contextKey struct{}
+
+// FromContext returns the user Middleware identified, it's false when authentication is disabled.
+func FromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(contextKey{}).(User)
+	return user, ok
+}
+
+// Middleware sends the requests of unknown users to the login page, the API gets a 401 instead.
+// Viewers may only read.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, ok := a.Identify(r)
+		switch {
+		case !ok && strings.HasPrefix(r.URL.Path, "/api/"):
+			w.Header().Set("WWW-Authenticate", `Basic realm="medicine"`)
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		case !ok && r.Method == http.MethodGet:
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		case !ok:
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		case !user.CanEdit() && r.Method != http.MethodGet && r.Method != http.MethodHead && r.URL.Path != "/logout":
+			slog.Warn("read only user tried to make a change", "user", user.Name, "method", r.Method, "path", r.URL.Path)
+			http.Error(w, fmt.Sprintf("%s can only view, ask a caregiver", user.Name), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, user)))
+	})
+}
+
+// SafeNext only follows redirections within the app, it's fallback for anything else.
+// Browsers read a backslash as a slash, so /\example.com is another site just like //example.com.
+func SafeNext(next, fallback string) string {
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.Contains(next, `\`) {
+		return fallback
+	}
+	return next
+}
+
+func (a *Authenticator) loginPage(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Next  string
+		Error string
+	}{
+		Next: SafeNext(r.URL.Query().Get("next"), "/"),
+	}
+	if r.Method == http.MethodPost {
+		data.Next = SafeNext(r.PostFormValue("next"), "/")
+		user, ok := a.login(r.PostFormValue("name"), r.PostFormValue("password"))
+		if ok {
+			slog.Info("login", "user", user.Name)
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    a.session(user, time.Now()),
+				Path:     "/",
+				MaxAge:   int(sessionDuration.Seconds()),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, data.Next, http.StatusSeeOther)
+			return
+		}
+		slog.Warn("failed login", "user", r.PostFormValue("name"), "from", r.RemoteAddr)
+		data.Error = "Unknown user or wrong password."
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	if err := templates.Login.Execute(w, data); err != nil {
+		http.Error(w, fmt.Sprintf("unable to execute template: %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (a *Authenticator) logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// Register adds the login and logout pages, before the routes of the handlers as they would catch them.
+func (a *Authenticator) Register(r *mux.Router) {
+	r.HandleFunc("/login", a.loginPage).Methods(http.MethodGet, http.MethodPost)
+	r.HandleFunc("/logout", a.logout).Methods(http.MethodPost)
+}
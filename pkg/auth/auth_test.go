@@ -0,0 +1,159 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nanassito/medicine/pkg/auth"
+)
+
+func newTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	hash, err := auth.HashPassword("secret")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	authenticator, err := auth.NewAuthenticator(auth.Config{
+		Users: []auth.User{
+			{Name: "Alice", Password: hash, Role: auth.RoleCaregiver},
+			{Name: "Bob", Password: hash, Role: auth.RoleViewer},
+		},
+		Header: "X-Forwarded-User",
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+	r := mux.NewRouter()
+	authenticator.Register(r)
+	r.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := auth.FromContext(r.Context())
+		w.Write([]byte("hello " + user.Name))
+	})
+	return authenticator.Middleware(r)
+}
+
+func login(t *testing.T, handler http.Handler, name, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	form := url.Values{"name": {name}, "password": {password}, "next": {"/Aspirin"}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := newTestServer(t)
+
+	alice := login(t, handler, "Alice", "secret")
+	if alice.Code != http.StatusSeeOther || alice.Header().Get("Location") != "/Aspirin" {
+		t.Fatalf("login status = %d to %q, want %d to /Aspirin", alice.Code, alice.Header().Get("Location"), http.StatusSeeOther)
+	}
+	bob := login(t, handler, "Bob", "secret")
+	if rec := login(t, handler, "Alice", "wrong"); rec.Code != http.StatusUnauthorized || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("login with a wrong password status = %d, want %d without a session", rec.Code, http.StatusUnauthorized)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		session    *httptest.ResponseRecorder
+		header     string
+		basic      [2]string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "Anonymous page", method: http.MethodGet, path: "/Aspirin", wantStatus: http.StatusSeeOther},
+		{name: "Anonymous API", method: http.MethodGet, path: "/api/v1/people", wantStatus: http.StatusUnauthorized},
+		{name: "Anonymous change", method: http.MethodPost, path: "/doses/delete", wantStatus: http.StatusUnauthorized},
+		{name: "Caregiver page", method: http.MethodGet, path: "/Aspirin", session: alice, wantStatus: http.StatusOK, wantBody: "hello Alice"},
+		{name: "Caregiver change", method: http.MethodPost, path: "/doses/delete", session: alice, wantStatus: http.StatusOK, wantBody: "hello Alice"},
+		{name: "Viewer page", method: http.MethodGet, path: "/Aspirin", session: bob, wantStatus: http.StatusOK, wantBody: "hello Bob"},
+		{name: "Viewer change", method: http.MethodPost, path: "/doses/delete", session: bob, wantStatus: http.StatusForbidden},
+		{name: "Viewer logout", method: http.MethodPost, path: "/logout", session: bob, wantStatus: http.StatusSeeOther},
+		{name: "Proxy listed user", method: http.MethodPost, path: "/doses/delete", header: "Alice", wantStatus: http.StatusOK, wantBody: "hello Alice"},
+		{name: "Proxy unknown user", method: http.MethodPost, path: "/doses/delete", header: "Carol", wantStatus: http.StatusForbidden},
+		{name: "Basic auth", method: http.MethodPost, path: "/api/v1/doses", basic: [2]string{"Alice", "secret"}, wantStatus: http.StatusOK, wantBody: "hello Alice"},
+		{name: "Basic auth wrong password", method: http.MethodPost, path: "/api/v1/doses", basic: [2]string{"Alice", "wrong"}, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.session != nil {
+				for _, cookie := range tt.session.Result().Cookies() {
+					req.AddCookie(cookie)
+				}
+			}
+			if tt.header != "" {
+				req.Header.Set("X-Forwarded-User", tt.header)
+			}
+			if tt.basic[0] != "" {
+				req.SetBasicAuth(tt.basic[0], tt.basic[1])
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, rec.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s body does not contain %q:\n%s", tt.method, tt.path, tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestForgedSession(t *testing.T) {
+	handler := newTestServer(t)
+	bob := login(t, handler, "Bob", "secret")
+	req := httptest.NewRequest(http.MethodGet, "/Aspirin", nil)
+	for _, cookie := range bob.Result().Cookies() {
+		// Swap the name for Alice's while keeping Bob's signature.
+		_, rest, _ := strings.Cut(cookie.Value, "|")
+		cookie.Value = "QWxpY2U|" + rest
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("GET with a forged session status = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	tests := []struct {
+		next string
+		want string
+	}{
+		{next: "/Aspirin/John?logged=abc", want: "/Aspirin/John?logged=abc"},
+		{next: "", want: "/"},
+		{next: "Aspirin", want: "/"},
+		{next: "//evil.example", want: "/"},
+		{next: `/\evil.example`, want: "/"},
+		{next: "https://evil.example/", want: "/"},
+		{next: "/path\x7f", want: "/"},
+	}
+	for _, tt := range tests {
+		if got := auth.SafeNext(tt.next, "/"); got != tt.want {
+			t.Errorf("SafeNext(%q) = %q, want %q", tt.next, got, tt.want)
+		}
+	}
+
+	rec := login(t, newTestServer(t), "Alice", "secret")
+	if location := rec.Header().Get("Location"); location != "/Aspirin" {
+		t.Errorf("login redirects to %q, want /Aspirin", location)
+	}
+	form := url.Values{"name": {"Alice"}, "password": {"secret"}, "next": {`/\evil.example`}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	newTestServer(t).ServeHTTP(rec, req)
+	if location := rec.Header().Get("Location"); location != "/" {
+		t.Errorf("login with next %q redirects to %q, want /", form.Get("next"), location)
+	}
+}
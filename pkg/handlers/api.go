@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+// The API mirrors the HTML pages for scripts and dashboards, durations are in seconds.
+
+type apiPerson struct {
+	Name     models.Person `json:"name"`
+	Birth    time.Time     `json:"birth"`
+	Weight   float64       `json:"weight"` // kg, from the latest measurement.
+	PhotoUrl string        `json:"photo_url,omitempty"`
+}
+
+type apiPosology struct {
+	HeavierThan             int64            `json:"heavier_than"`
+	OlderThanSeconds        int64            `json:"older_than_seconds"`
+	LighterThan             int64            `json:"lighter_than,omitempty"`         // 0 means no upper bound.
+	YoungerThanSeconds      int64            `json:"younger_than_seconds,omitempty"` // 0 means no upper bound.
+	Match                   models.MatchRule `json:"match,omitempty"`
+	Dose                    string           `json:"dose"`
+	DoseIntervalSeconds     int64            `json:"dose_interval_seconds"`
+	MaxDoses                int64            `json:"max_doses"`
+	MaxDosesIntervalSeconds int64            `json:"max_doses_interval_seconds"`
+	PerKg                   float64          `json:"mg_per_kg,omitempty"`
+	Concentration           float64          `json:"mg_per_ml,omitempty"`
+	MaxSingleDose           float64          `json:"max_single_dose_mg,omitempty"`
+	Graduation              float64          `json:"graduation_ml,omitempty"`
+	Ingredient              string           `json:"ingredient,omitempty"`
+	Strength                float64          `json:"strength_mg,omitempty"`
+	MaxDaily                float64          `json:"max_daily_mg,omitempty"`
+	MaxDailyPerKg           float64          `json:"max_daily_mg_per_kg,omitempty"`
+}
+
+type apiMedicine struct {
+	Name     models.Medicine `json:"name"`
+	Posology []apiPosology   `json:"posology"`
+}
+
+type apiDose struct {
+	ID             string          `json:"id"`
+	Person         models.Person   `json:"person"`
+	Medicine       models.Medicine `json:"medicine"`
+	When           time.Time       `json:"when"`
+	Override       bool            `json:"override,omitempty"`
+	OverrideReason string          `json:"override_reason,omitempty"`
+	GivenBy        string          `json:"given_by,omitempty"`
+}
+
+type apiDoseRecord struct {
+	apiDose
+	Posology      *apiPosology `json:"posology,omitempty"`
+	PosologyError string       `json:"posology_error,omitempty"`
+	TooSoon       bool         `json:"too_soon"`
+	TooMany       bool         `json:"too_many"`
+	TooMuch       bool         `json:"too_much"`
+	Violation     string       `json:"violation,omitempty"`
+	Respected     bool         `json:"respected"`
+}
+
+type apiCanTake struct {
+	CanTake        bool         `json:"can_take"`
+	Reason         string       `json:"reason"`
+	Posology       *apiPosology `json:"posology,omitempty"`
+	WaitForSeconds int64        `json:"wait_for_seconds"`
+}
+
+// apiLogDose is the body expected to log a dose, ID is an optional idempotency key.
+type apiLogDose struct {
+	ID             string          `json:"id"`
+	Person         models.Person   `json:"person"`
+	Medicine       models.Medicine `json:"medicine"`
+	Override       bool            `json:"override"`
+	OverrideReason string          `json:"override_reason"`
+}
+
+type apiError struct {
+	Error     string      `json:"error"`
+	Evaluated *apiCanTake `json:"evaluated,omitempty"` // Why the dose was refused.
+}
+
+func toAPIPosology(entry models.PosologyEntry) apiPosology {
+	return apiPosology{
+		HeavierThan:             entry.HeavierThan,
+		OlderThanSeconds:        int64(entry.OlderThan.Seconds()),
+		LighterThan:             entry.LighterThan,
+		YoungerThanSeconds:      int64(entry.YoungerThan.Seconds()),
+		Match:                   entry.Match,
+		Dose:                    entry.Dose,
+		DoseIntervalSeconds:     int64(entry.DoseInterval.Seconds()),
+		MaxDoses:                entry.MaxDoses,
+		MaxDosesIntervalSeconds: int64(entry.MaxDosesInterval.Seconds()),
+		PerKg:                   entry.PerKg,
+		Concentration:           entry.Concentration,
+		MaxSingleDose:           entry.MaxSingleDose,
+		Graduation:              entry.Graduation,
+		Ingredient:              entry.Ingredient,
+		Strength:                entry.Strength,
+		MaxDaily:                entry.MaxDaily,
+		MaxDailyPerKg:           entry.MaxDailyPerKg,
+	}
+}
+
+func toAPIDose(dose models.Dose) apiDose {
+	return apiDose{
+		ID:             dose.Key(),
+		Person:         dose.Who,
+		Medicine:       dose.What,
+		When:           dose.When,
+		Override:       dose.Override,
+		OverrideReason: dose.OverrideReason,
+		GivenBy:        dose.GivenBy,
+	}
+}
+
+func toAPICanTake(canTake bool, reason string, posology models.PosologyEntry, waitFor time.Duration) apiCanTake {
+	evaluated := apiCanTake{CanTake: canTake, Reason: reason, WaitForSeconds: int64(waitFor.Seconds())}
+	if posology != (models.PosologyEntry{}) {
+		p := toAPIPosology(posology)
+		evaluated.Posology = &p
+	}
+	return evaluated
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("unable to encode the response", "error", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, apiError{Error: fmt.Sprintf(format, args...)})
+}
+
+// apiSnapshot loads the snapshot and checks the medicine and person in the path if any.
+func (h *MedicineHandler) apiSnapshot(w http.ResponseWriter, r *http.Request) (models.Snapshot, bool) {
+	vars := mux.Vars(r)
+	snapshot, err := h.Store.Snapshot(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "unable to retrieve data: %v", err)
+		return snapshot, false
+	}
+	if medicineName, ok := vars["medicine"]; ok && !snapshot.HasMedicine(models.Medicine(medicineName)) {
+		writeJSONError(w, http.StatusNotFound, "medicine %s not found", medicineName)
+		return snapshot, false
+	}
+	if personName, ok := vars["person"]; ok && !snapshot.HasPerson(models.Person(personName)) {
+		writeJSONError(w, http.StatusNotFound, "person %s not found", personName)
+		return snapshot, false
+	}
+	return snapshot, true
+}
+
+func (h *MedicineHandler) apiPeople(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := h.apiSnapshot(w, r)
+	if !ok {
+		return
+	}
+	people := make([]apiPerson, 0, len(snapshot.People))
+	for _, person := range snapshot.People {
+		weight, _ := snapshot.Weight(person.Name, h.now())
+		people = append(people, apiPerson{Name: person.Name, Birth: person.Birth, Weight: weight, PhotoUrl: person.PhotoUrl})
+	}
+	writeJSON(w, http.StatusOK, people)
+}
+
+func (h *MedicineHandler) apiMedicines(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := h.apiSnapshot(w, r)
+	if !ok {
+		return
+	}
+	medicines := make([]apiMedicine, 0, len(snapshot.Medicines))
+	for name, medicine := range snapshot.Medicines {
+		posology := make([]apiPosology, 0, len(medicine.Posology))
+		for _, entry := range medicine.Posology {
+			posology = append(posology, toAPIPosology(entry))
+		}
+		medicines = append(medicines, apiMedicine{Name: name, Posology: posology})
+	}
+	sort.Slice(medicines, func(i, j int) bool { return medicines[i].Name < medicines[j].Name })
+	writeJSON(w, http.StatusOK, medicines)
+}
+
+func (h *MedicineHandler) apiPosology(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := h.apiSnapshot(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	posology, err := snapshot.GetPosology(models.Person(vars["person"]), models.Medicine(vars["medicine"]))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "no posology applies: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIPosology(posology))
+}
+
+func (h *MedicineHandler) apiCanTake(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := h.apiSnapshot(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	writeJSON(w, http.StatusOK, toAPICanTake(snapshot.CanTake(models.Person(vars["person"]), models.Medicine(vars["medicine"]))))
+}
+
+// apiHistory lists the doses of a person, the medicine query parameter narrows it to a single medicine.
+func (h *MedicineHandler) apiHistory(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := h.apiSnapshot(w, r)
+	if !ok {
+		return
+	}
+	medicineName := models.Medicine(r.URL.Query().Get("medicine"))
+	if medicineName != "" && !snapshot.HasMedicine(medicineName) {
+		writeJSONError(w, http.StatusNotFound, "medicine %s not found", medicineName)
+		return
+	}
+	history := snapshot.History(models.Person(mux.Vars(r)["person"]), medicineName)
+	records := make([]apiDoseRecord, 0, len(history))
+	for _, record := range history {
+		rec := apiDoseRecord{
+			apiDose:       toAPIDose(record.Dose),
+			PosologyError: record.PosologyError,
+			TooSoon:       record.TooSoon,
+			TooMany:       record.TooMany,
+			TooMuch:       record.TooMuch,
+			Violation:     record.Violation,
+			Respected:     record.Respected(),
+		}
+		if record.PosologyError == "" {
+			p := toAPIPosology(record.Posology)
+			rec.Posology = &p
+		}
+		records = append(records, rec)
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// apiLogDose follows the same rules as the Take button: doses CanTake refuses need an override with a reason.
+func (h *MedicineHandler) apiLogDose(w http.ResponseWriter, r *http.Request) {
+	// Browsers can't send a JSON body cross site without a preflight, this is what protects the API from CSRF.
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "the body must be application/json")
+		return
+	}
+	var req apiLogDose
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "unable to decode the body: %v", err)
+		return
+	}
+	snapshot, ok := h.apiSnapshot(w, r)
+	if !ok {
+		return
+	}
+	if !snapshot.HasMedicine(req.Medicine) {
+		writeJSONError(w, http.StatusNotFound, "medicine %s not found", req.Medicine)
+		return
+	}
+	if !snapshot.HasPerson(req.Person) {
+		writeJSONError(w, http.StatusNotFound, "person %s not found", req.Person)
+		return
+	}
+
+	key := req.ID
+	if key == "" {
+		key = rand.Text()
+	}
+	if dose, ok := snapshot.GetDose(key); ok {
+		writeJSON(w, http.StatusOK, toAPIDose(dose))
+		return
+	}
+	if !h.taken.claim(key, time.Now()) {
+		writeJSONError(w, http.StatusConflict, "dose %s is already being recorded", key)
+		return
+	}
+
+	canTake, reason, posology, waitFor := snapshot.CanTake(req.Person, req.Medicine)
+	overrideReason := strings.TrimSpace(req.OverrideReason)
+	if _, blocked := snapshot.Violation(req.Person, req.Medicine, h.now(), true); blocked {
+		h.taken.release(key)
+		evaluated := toAPICanTake(canTake, reason, posology, waitFor)
+		writeJSON(w, http.StatusConflict, apiError{Error: "an interaction or contraindication rule forbids this dose", Evaluated: &evaluated})
+		return
+	}
+	if !canTake && (!req.Override || overrideReason == "") {
+		h.taken.release(key)
+		evaluated := toAPICanTake(canTake, reason, posology, waitFor)
+		writeJSON(w, http.StatusConflict, apiError{Error: "the posology doesn't allow this dose, override it with a reason", Evaluated: &evaluated})
+		return
+	}
+
+	dose := models.Dose{ID: key, Who: req.Person, What: req.Medicine, When: h.now(), GivenBy: caregiver(r)}
+	if !canTake {
+		slog.Warn("overriding posology", "person", req.Person, "medicine", req.Medicine, "rule", reason, "reason", overrideReason)
+		dose.Override = true
+		dose.OverrideReason = overrideReason
+	}
+	if err := h.Store.LogDose(r.Context(), dose); err != nil {
+		h.taken.release(key)
+		writeJSONError(w, http.StatusInternalServerError, "unable to register that %s was taken by %s: %v", req.Medicine, req.Person, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toAPIDose(dose))
+}
+
+func (h *MedicineHandler) registerAPI(r *mux.Router) {
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/people", h.apiPeople).Methods(http.MethodGet)
+	api.HandleFunc("/people/{person}/doses", h.apiHistory).Methods(http.MethodGet)
+	api.HandleFunc("/medicines", h.apiMedicines).Methods(http.MethodGet)
+	api.HandleFunc("/medicines/{medicine}/posology/{person}", h.apiPosology).Methods(http.MethodGet)
+	api.HandleFunc("/medicines/{medicine}/can-take/{person}", h.apiCanTake).Methods(http.MethodGet)
+	api.HandleFunc("/doses", h.apiLogDose).Methods(http.MethodPost)
+}
@@ -0,0 +1,196 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+func TestAPI(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       any
+	}{
+		{name: "People", path: "/api/v1/people", wantStatus: http.StatusOK, want: []any{map[string]any{"name": "John", "weight": float64(0)}}},
+		{name: "Medicines", path: "/api/v1/medicines", wantStatus: http.StatusOK, want: []any{map[string]any{"name": "Aspirin"}}},
+		{name: "Posology", path: "/api/v1/medicines/Aspirin/posology/John", wantStatus: http.StatusOK, want: map[string]any{"dose": "1 pill", "dose_interval_seconds": float64(6 * 3600)}},
+		{name: "Posology unknown person", path: "/api/v1/medicines/Aspirin/posology/Jane", wantStatus: http.StatusNotFound},
+		{name: "Can take", path: "/api/v1/medicines/Aspirin/can-take/John", wantStatus: http.StatusOK, want: map[string]any{"can_take": true, "reason": "they never had a dose"}},
+		{name: "Can take unknown medicine", path: "/api/v1/medicines/Unknown/can-take/John", wantStatus: http.StatusNotFound},
+		{name: "History", path: "/api/v1/people/John/doses?medicine=Aspirin", wantStatus: http.StatusOK, want: []any{}},
+		{name: "History unknown medicine", path: "/api/v1/people/John/doses?medicine=Unknown", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t, &fakeStore{snapshot: testSnapshot()})
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("GET %s status = %d, want %d\n%s", tt.path, rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("GET %s content type = %q, want application/json", tt.path, got)
+			}
+			var got any
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("GET %s returned invalid JSON: %v", tt.path, err)
+			}
+			if tt.want != nil && !contains(got, tt.want) {
+				t.Errorf("GET %s = %s, want it to contain %v", tt.path, rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIPosology(t *testing.T) {
+	snapshot := testSnapshot()
+	snapshot.Medicines["Aspirin"].Posology = []models.PosologyEntry{{
+		OlderThan: 2 * 365 * 24 * time.Hour, YoungerThan: 18 * 365 * 24 * time.Hour, LighterThan: 50, Match: models.MatchAny,
+		Dose: "1 pill", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour,
+		Ingredient: "acetylsalicylic acid", Strength: 500, MaxDaily: 2000, MaxDailyPerKg: 60,
+	}}
+	r := newTestRouter(t, &fakeStore{snapshot: snapshot})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/medicines/Aspirin/posology/John", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET posology status = %d, want %d\n%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var got any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("GET posology returned invalid JSON: %v", err)
+	}
+	want := map[string]any{
+		"younger_than_seconds": float64(18 * 365 * 24 * 3600),
+		"lighter_than":         float64(50),
+		"match":                "any",
+		"ingredient":           "acetylsalicylic acid",
+		"strength_mg":          float64(500),
+		"max_daily_mg":         float64(2000),
+		"max_daily_mg_per_kg":  float64(60),
+	}
+	if !contains(got, want) {
+		t.Errorf("GET posology = %s, want it to contain %v", rec.Body.String(), want)
+	}
+}
+
+func TestAPIHistory(t *testing.T) {
+	now := time.Now()
+	snapshot := testSnapshot()
+	snapshot.Medicines["Aspirin"].Posology[0].Ingredient = "acetylsalicylic acid"
+	snapshot.Medicines["Aspirin"].Posology[0].Strength = 500
+	snapshot.Medicines["Aspirin"].Posology[0].MaxDaily = 800
+	snapshot.Medicines["Ibuprofen"] = &models.MedicineCfg{Posology: []models.PosologyEntry{{Dose: "1 pill", DoseInterval: 6 * time.Hour}}}
+	snapshot.Interactions = []models.Interaction{{Medicine: "Aspirin", Other: "Ibuprofen", Within: 8 * time.Hour, Note: "reduces the effect of aspirin"}}
+	snapshot.AddDose(models.Dose{Who: "John", What: "Ibuprofen", When: now.Add(-10 * time.Hour)})
+	snapshot.AddDose(models.Dose{Who: "John", What: "Aspirin", When: now.Add(-8 * time.Hour)})
+	snapshot.AddDose(models.Dose{Who: "John", What: "Aspirin", When: now.Add(-time.Hour)})
+
+	r := newTestRouter(t, &fakeStore{snapshot: snapshot})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/people/John/doses?medicine=Aspirin", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET doses status = %d, want %d\n%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var got any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("GET doses returned invalid JSON: %v", err)
+	}
+	want := []any{
+		map[string]any{"too_much": true, "respected": false},
+		map[string]any{"too_much": false, "violation": "Aspirin must not be given within 8h0m0s of Ibuprofen: reduces the effect of aspirin", "respected": false},
+	}
+	if !contains(got, want) {
+		t.Errorf("GET doses = %s, want it to contain %v", rec.Body.String(), want)
+	}
+}
+
+// contains tells whether every field of want is found in got, fields absent from want are ignored.
+func contains(got, want any) bool {
+	switch want := want.(type) {
+	case map[string]any:
+		got, ok := got.(map[string]any)
+		if !ok {
+			return false
+		}
+		for key, value := range want {
+			if !contains(got[key], value) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		got, ok := got.([]any)
+		if !ok || len(got) != len(want) {
+			return false
+		}
+		for i := range want {
+			if !contains(got[i], want[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return cmp.Equal(got, want)
+	}
+}
+
+func postJSON(r http.Handler, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPILogDose(t *testing.T) {
+	st := &fakeStore{snapshot: testSnapshot()}
+	r := newTestRouter(t, st)
+
+	rec := postJSON(r, "/api/v1/doses", `{"id": "abc", "person": "John", "medicine": "Aspirin"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("first dose status = %d, want %d\n%s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if rec := postJSON(r, "/api/v1/doses", `{"id": "abc", "person": "John", "medicine": "Aspirin"}`); rec.Code != http.StatusOK {
+		t.Errorf("retried dose status = %d, want %d\n%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	rec = postJSON(r, "/api/v1/doses", `{"person": "John", "medicine": "Aspirin"}`)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "their last dose is too recent") {
+		t.Errorf("second dose = %d %s, want it refused because the last dose is too recent", rec.Code, rec.Body.String())
+	}
+	if rec := postJSON(r, "/api/v1/doses", `{"person": "John", "medicine": "Aspirin", "override": true, "override_reason": "doctor said so"}`); rec.Code != http.StatusCreated {
+		t.Errorf("overridden dose status = %d, want %d\n%s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/doses", strings.NewReader(`person=John&medicine=Aspirin`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("form post status = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+
+	want := []models.Dose{
+		{ID: "abc", Who: "John", What: "Aspirin", GivenBy: "192.0.2.1"}, // The address of the caller without authentication.
+		{Who: "John", What: "Aspirin", Override: true, OverrideReason: "doctor said so", GivenBy: "192.0.2.1"},
+	}
+	ignoreGenerated := cmp.Transformer("", func(d models.Dose) models.Dose {
+		if d.ID != "abc" {
+			d.ID = ""
+		}
+		d.When = time.Time{}
+		return d
+	})
+	if diff := cmp.Diff(want, st.logged, ignoreGenerated); diff != "" {
+		t.Errorf("logged doses mismatch (-want +got):\n%s", diff)
+	}
+}
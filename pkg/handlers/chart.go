@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+const (
+	chartWidth  = 600.0
+	chartHeight = 240.0
+	chartMargin = 30.0 // Room for the labels on the left and at the bottom.
+	feverAt     = 38.0 // °C
+)
+
+type chartPoint struct {
+	X, Y  float64
+	Label string
+}
+
+// temperatureChart lays out the temperature readings of someone and the doses they had as an SVG chart.
+type temperatureChart struct {
+	Width, Height float64
+	Left, Bottom  float64 // Where the plotting area starts.
+	Line          string  // The points of the temperature polyline.
+	Readings      []chartPoint
+	Doses         []chartPoint // Only X is meaningful, they are drawn as vertical lines.
+	Degrees       []chartPoint // Only Y is meaningful, one per °C.
+	Days          []chartPoint // Only X is meaningful, one per midnight.
+	FeverY        float64
+}
+
+func newTemperatureChart(observations []models.Observation, doses []models.Dose, from, to time.Time) temperatureChart {
+	c := temperatureChart{Width: chartWidth, Height: chartHeight, Left: chartMargin, Bottom: chartHeight - chartMargin}
+	low, high := 36.0, 40.0
+	for _, observation := range observations {
+		if observation.Temperature != 0 {
+			low = math.Min(low, math.Floor(observation.Temperature))
+			high = math.Max(high, math.Ceil(observation.Temperature))
+		}
+	}
+	x := func(t time.Time) float64 {
+		return c.Left + (chartWidth-c.Left)*float64(t.Sub(from))/float64(to.Sub(from))
+	}
+	y := func(temperature float64) float64 {
+		return c.Bottom - c.Bottom*(temperature-low)/(high-low)
+	}
+
+	points := make([]string, 0, len(observations))
+	for _, observation := range observations {
+		if observation.Temperature == 0 {
+			continue
+		}
+		point := chartPoint{
+			X:     x(observation.When),
+			Y:     y(observation.Temperature),
+			Label: fmt.Sprintf("%v°C at %s", observation.Temperature, observation.When.Format("Mon 15:04")),
+		}
+		if observation.Symptoms != "" {
+			point.Label += ": " + observation.Symptoms
+		}
+		c.Readings = append(c.Readings, point)
+		points = append(points, fmt.Sprintf("%.1f,%.1f", point.X, point.Y))
+	}
+	c.Line = strings.Join(points, " ")
+	for _, dose := range doses {
+		c.Doses = append(c.Doses, chartPoint{X: x(dose.When), Label: fmt.Sprintf("%s at %s", dose.What, dose.When.Format("Mon 15:04"))})
+	}
+	for degree := low; degree <= high; degree++ {
+		c.Degrees = append(c.Degrees, chartPoint{Y: y(degree), Label: fmt.Sprintf("%v°", degree)})
+	}
+	midnight := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	for day := midnight.AddDate(0, 0, 1); day.Before(to); day = day.AddDate(0, 0, 1) {
+		c.Days = append(c.Days, chartPoint{X: x(day), Label: day.Format("Mon 02")})
+	}
+	c.FeverY = y(feverAt)
+	return c
+}
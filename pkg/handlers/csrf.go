@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	csrfCookie = "csrf"
+	csrfField  = "csrf"
+	// Submissions reusing an idempotency key within that window are only recorded once.
+	idempotencyWindow = 10 * time.Minute
+	idempotencyField  = "idempotency_key"
+)
+
+// csrfToken binds forms to the browser through a random cookie, the token is the signed cookie value.
+// A cross site form can't read the cookie so it can't forge the token.
+func (h *MedicineHandler) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		cookie = &http.Cookie{
+			Name:     csrfCookie,
+			Value:    rand.Text(),
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}
+		http.SetCookie(w, cookie)
+	}
+	return h.signCSRF(cookie.Value)
+}
+
+func (h *MedicineHandler) signCSRF(value string) string {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (h *MedicineHandler) validCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return hmac.Equal([]byte(r.PostFormValue(csrfField)), []byte(h.signCSRF(cookie.Value)))
+}
+
+// idempotency remembers the keys of the submissions recorded recently.
+type idempotency struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// claim returns false if the key was already claimed within the window.
+func (i *idempotency) claim(key string, now time.Time) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.seen == nil {
+		i.seen = make(map[string]time.Time)
+	}
+	for k, at := range i.seen {
+		if now.Sub(at) > idempotencyWindow {
+			delete(i.seen, k)
+		}
+	}
+	if _, ok := i.seen[key]; ok {
+		return false
+	}
+	i.seen[key] = now
+	return true
+}
+
+// release forgets a key so that the submission can be retried, eg. when recording it failed.
+func (i *idempotency) release(key string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.seen, key)
+}
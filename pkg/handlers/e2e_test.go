@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nanassito/medicine/pkg/handlers"
+	"github.com/nanassito/medicine/pkg/store"
+	"github.com/nanassito/medicine/pkg/store/sheetstest"
+)
+
+func TestEndToEnd(t *testing.T) {
+	sheet := sheetstest.NewServer(t, "testdata/sheets")
+	st, err := store.NewSheets(sheet.Service(t), store.DefaultSheetsConfig)
+	if err != nil {
+		t.Fatalf("NewSheets() error = %v", err)
+	}
+	handler, err := handlers.NewMedicineHandler(st)
+	if err != nil {
+		t.Fatalf("NewMedicineHandler() error = %v", err)
+	}
+	r := mux.NewRouter()
+	handler.Register(r)
+
+	// Each step either GETs path, or when page is set, submits the forms of that page to path.
+	// A page of "<" is wherever the last redirection went to.
+	steps := []struct {
+		name         string
+		page         string
+		path         string
+		wantStatus   int
+		wantBody     string
+		wantLocation string
+	}{
+		{name: "List", path: "/", wantStatus: http.StatusOK, wantBody: `href="./Doliprane"`},
+		{name: "Overview", path: "/Aspirin", wantStatus: http.StatusOK, wantBody: `href="/Aspirin/Jane"`},
+		{name: "Too young", path: "/Aspirin/Jane", wantStatus: http.StatusOK, wantBody: "they are too young"},
+		{name: "Before the dose", path: "/Aspirin/John", wantStatus: http.StatusOK, wantBody: "they never had a dose"},
+		{name: "Take", page: "/Aspirin/John", path: "/Aspirin/John/take", wantStatus: http.StatusSeeOther, wantLocation: "/Aspirin?logged="},
+		{name: "After the dose", path: "/Aspirin/John", wantStatus: http.StatusOK, wantBody: "their last dose is too recent"},
+		{name: "Undo", page: "<", path: "/doses/delete", wantStatus: http.StatusSeeOther, wantLocation: "/Aspirin"},
+		{name: "After the undo", path: "/Aspirin/John", wantStatus: http.StatusOK, wantBody: "they never had a dose"},
+	}
+	location := ""
+	for _, step := range steps {
+		rec := httptest.NewRecorder()
+		switch step.page {
+		case "":
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, step.path, nil))
+		case "<":
+			form, cookies := takeForm(t, r, location)
+			rec = postForm(r, step.path, form, cookies)
+		default:
+			form, cookies := takeForm(t, r, step.page)
+			rec = postForm(r, step.path, form, cookies)
+		}
+		if rec.Code != step.wantStatus {
+			t.Fatalf("%s: %s status = %d, want %d\n%s", step.name, step.path, rec.Code, step.wantStatus, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), step.wantBody) {
+			t.Fatalf("%s: %s body does not contain %q:\n%s", step.name, step.path, step.wantBody, rec.Body.String())
+		}
+		got := rec.Header().Get("Location")
+		if !strings.HasPrefix(got, step.wantLocation) {
+			t.Fatalf("%s: %s redirected to %q, want %q", step.name, step.path, got, step.wantLocation)
+		}
+		if got != "" {
+			location = got
+		}
+	}
+
+	events := sheet.Tab("Events")
+	if len(events) != 3 {
+		t.Fatalf("Events has %d rows, want 3: %v", len(events), events)
+	}
+	if got := events[2]; got[1] != "John" || got[2] != "Aspirin" || got[7] != "192.0.2.1" || got[8] != "192.0.2.1" {
+		t.Errorf("logged event = %v, want a dose of Aspirin for John given and deleted from 192.0.2.1", got)
+	}
+	if audit := sheet.Tab("Audit"); len(audit) != 2 {
+		t.Errorf("Audit = %v, want a single entry", audit)
+	}
+}
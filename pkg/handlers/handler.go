@@ -1,23 +1,60 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 
+	"github.com/nanassito/medicine/pkg/auth"
 	"github.com/nanassito/medicine/pkg/models"
+	"github.com/nanassito/medicine/pkg/store"
 	"github.com/nanassito/medicine/pkg/templates"
 )
 
+var (
+	ErrTooYoung = errors.New("too young to use this medicine at all")
+	ErrTooSoon  = errors.New("too soon to take another dose")
+)
+
+type MedicineHandler struct {
+	Store store.Store
+	// WeightMaxAge is how old the last weight measurement can get before medicineFor warns about it.
+	WeightMaxAge time.Duration
+	// Location is the time zone of the household, the pages show the times in it.
+	Location *time.Location
+
+	secret []byte // Signs the CSRF tokens.
+	taken  idempotency
+}
+
+func NewMedicineHandler(st store.Store) (*MedicineHandler, error) {
+	if st == nil {
+		return nil, errors.New("missing store")
+	}
+	return &MedicineHandler{Store: st, WeightMaxAge: 90 * 24 * time.Hour, Location: time.Local, secret: []byte(rand.Text())}, nil
+}
+
+// now is the current time in the time zone of the household.
+func (h *MedicineHandler) now() time.Time {
+	return time.Now().In(h.Location)
+}
+
 func (h *MedicineHandler) medicineOverview(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	slog.Info("selection", "vars", vars)
 
-	snapshot, err := h.getAll(r.Context())
+	snapshot, err := h.Store.Snapshot(r.Context())
 	if err != nil {
 		http.Error(w, fmt.Sprintf("unable to retrieve data: %v", err), http.StatusInternalServerError)
 		return
@@ -28,12 +65,24 @@ func (h *MedicineHandler) medicineOverview(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Right after a dose is logged, offer to undo it in case it was given to the wrong person.
+	var logged *models.Dose
+	if dose, ok := snapshot.GetDose(r.URL.Query().Get("logged")); ok {
+		logged = &dose
+	}
+
 	data := struct {
 		MedicineName models.Medicine
 		People       []models.PersonCfg
+		Age          time.Duration
+		Logged       *models.Dose
+		CSRF         string
 	}{
 		MedicineName: medicineName,
 		People:       snapshot.People,
+		Age:          snapshot.Age(),
+		Logged:       logged,
+		CSRF:         h.csrfToken(w, r),
 	}
 	if err = templates.MedicineOverview.Execute(w, data); err != nil {
 		http.Error(w, fmt.Sprintf("unable to execute template: %v", err), http.StatusInternalServerError)
@@ -44,7 +93,7 @@ func (h *MedicineHandler) take(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	slog.Info("selection", "vars", vars)
 
-	snapshot, err := h.getAll(r.Context())
+	snapshot, err := h.Store.Snapshot(r.Context())
 	if err != nil {
 		http.Error(w, fmt.Sprintf("unable to retrieve data: %v", err), http.StatusInternalServerError)
 		return
@@ -61,38 +110,184 @@ func (h *MedicineHandler) take(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = h.logDoseIntake(personName, medicineName); err != nil {
-		http.Error(w, fmt.Sprintf("unable to register that %s was taken by %s: %v", medicineName, personName, err), http.StatusInternalServerError)
+	if !h.validCSRF(r) {
+		http.Error(w, "invalid or missing CSRF token, reload the page and try again", http.StatusForbidden)
+		return
+	}
+	key := r.PostFormValue(idempotencyField)
+	if key == "" {
+		http.Error(w, "missing idempotency key", http.StatusBadRequest)
 		return
 	}
 
-	canTake, reason, posology, waitFor := snapshot.CanTake(personName, medicineName)
+	// The dose may already be recorded if this is a retry or a double tap.
+	if _, ok := snapshot.GetDose(key); ok || !h.taken.claim(key, time.Now()) {
+		slog.Info("dose already recorded", "person", personName, "medicine", medicineName, "key", key)
+		http.Redirect(w, r, fmt.Sprintf("/%s?logged=%s", medicineName, url.QueryEscape(key)), http.StatusSeeOther)
+		return
+	}
+
+	now := h.now()
+	at, err := h.givenAt(r, now)
+	if err != nil {
+		h.taken.release(key)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	backdated := at.Before(now)
+	canTake, reason, posology, waitFor := snapshot.CanTakeAt(personName, medicineName, at)
+	_, blocked := snapshot.Violation(personName, medicineName, at, true)
+	// A backdated dose may make the ones logged since break the posology or a rule.
+	if later, ok := snapshot.BreaksLater(personName, medicineName, at); ok && (canTake || later.Violation != "") {
+		canTake, blocked = false, blocked || later.Violation != ""
+		reason = fmt.Sprintf("their dose of %s on %s would then break the posology", later.What, later.When.Format("Mon 02 Jan 15:04"))
+		if later.Violation != "" {
+			reason = fmt.Sprintf("their dose of %s on %s would then break a rule: %s", later.What, later.When.Format("Mon 02 Jan 15:04"), later.Violation)
+		}
+	}
+	if backdated {
+		waitFor = 0 // It's about when it was given, there is nothing to wait for.
+	}
+	override := r.PostFormValue("override") != ""
+	overrideReason := strings.TrimSpace(r.PostFormValue("reason"))
+	if !canTake && (blocked || !override || overrideReason == "") {
+		data := struct {
+			MedicineName   models.Medicine
+			Who            models.PersonCfg
+			Reason         string
+			Posology       models.PosologyEntry
+			WaitFor        time.Duration
+			Blocked        bool
+			MissingReason  bool
+			CSRF           string
+			IdempotencyKey string
+			GivenAt        string // Only when backdated.
+		}{
+			MedicineName:   medicineName,
+			Who:            snapshot.GetPerson(personName),
+			Reason:         reason,
+			Posology:       posology,
+			WaitFor:        waitFor.Round(time.Minute),
+			Blocked:        blocked,
+			MissingReason:  override,
+			CSRF:           h.csrfToken(w, r),
+			IdempotencyKey: key,
+		}
+		if backdated {
+			data.GivenAt = at.Format(givenAtLayout)
+		}
+		h.taken.release(key) // Nothing was recorded, the caregiver may still override with the same key unless it's blocked.
+		w.WriteHeader(http.StatusConflict)
+		if err = templates.Refused.Execute(w, data); err != nil {
+			http.Error(w, fmt.Sprintf("unable to execute template: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	dose := models.Dose{ID: key, Who: personName, What: medicineName, When: at, GivenBy: caregiver(r)}
+	if backdated {
+		slog.Info("backdated dose", "person", personName, "medicine", medicineName, "at", at)
+	}
 	if !canTake {
-		if waitFor > time.Duration(0.9*float64(posology.DoseInterval)) {
-			w.Write([]byte(fmt.Sprintf("Do NOT take this ! %s", reason)))
-			return
+		slog.Warn("overriding posology", "person", personName, "medicine", medicineName, "rule", reason, "reason", overrideReason)
+		dose.Override = true
+		dose.OverrideReason = overrideReason
+	}
+	if err = h.Store.LogDose(r.Context(), dose); err != nil {
+		h.taken.release(key)
+		http.Error(w, fmt.Sprintf("unable to register that %s was taken by %s: %v", medicineName, personName, err), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/%s?logged=%s", medicineName, url.QueryEscape(key)), http.StatusSeeOther)
+}
+
+// givenAtLayout is the one of the datetime-local inputs.
+const givenAtLayout = "2006-01-02T15:04"
+
+// givenAt is when the dose of the take form was given, either at a time of the household or some time ago.
+// It's now unless the dose is logged after the fact, eg. in the morning for one given at night.
+func (h *MedicineHandler) givenAt(r *http.Request, now time.Time) (time.Time, error) {
+	at := now
+	when, ago := r.PostFormValue("when"), r.PostFormValue("ago")
+	if when != "" && ago != "" {
+		return at, fmt.Errorf("the dose can't be given both %s ago and at %s, pick one", ago, when)
+	}
+	if when != "" {
+		var err error
+		if at, err = time.ParseInLocation(givenAtLayout, when, h.Location); err != nil {
+			return at, fmt.Errorf("invalid time %q", when)
+		}
+	} else if ago != "" {
+		duration, err := time.ParseDuration(ago)
+		if err != nil || duration < 0 {
+			return at, fmt.Errorf("invalid duration %q", ago)
 		}
+		at = now.Add(-duration)
+	}
+	if at.After(now) {
+		return at, fmt.Errorf("%s is in the future, only doses already given can be logged", at.Format("Mon 02 Jan 15:04"))
 	}
+	return at, nil
+}
+
+func (h *MedicineHandler) deleteDose(w http.ResponseWriter, r *http.Request) {
+	if !h.validCSRF(r) {
+		http.Error(w, "invalid or missing CSRF token, reload the page and try again", http.StatusForbidden)
+		return
+	}
+	key := r.PostFormValue("key")
+	err := h.Store.DeleteDose(r.Context(), key, caregiver(r))
+	if errors.Is(err, store.ErrDoseNotFound) {
+		http.Error(w, fmt.Sprintf("dose %s not found, it may have been deleted already", key), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to delete dose %s: %v", key, err), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, auth.SafeNext(r.PostFormValue("next"), "/"), http.StatusSeeOther)
+}
 
-	http.Redirect(w, r, fmt.Sprintf("/%s", medicineName), http.StatusSeeOther)
+// caregiver identifies who is using the app, by their address when authentication is disabled.
+func caregiver(r *http.Request) string {
+	if user, ok := auth.FromContext(r.Context()); ok {
+		return user.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 func (h *MedicineHandler) list(w http.ResponseWriter, r *http.Request) {
-	snapshot, err := h.getAll(r.Context())
+	snapshot, err := h.Store.Snapshot(r.Context())
 	if err != nil {
 		http.Error(w, fmt.Sprintf("unable to retrieve data: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	medicines := make([]string, 0)
+	type card struct {
+		Name  models.Medicine
+		Stock models.StockStatus
+	}
+	now := h.now()
+	medicines := make([]card, 0)
 	for medicine := range snapshot.Medicines {
-		medicines = append(medicines, string(medicine))
+		medicines = append(medicines, card{Name: medicine, Stock: snapshot.Stock(medicine, now)})
 	}
-	sort.Strings(medicines)
+	sort.Slice(medicines, func(i, j int) bool { return medicines[i].Name < medicines[j].Name })
+	user, _ := auth.FromContext(r.Context())
 	data := struct {
-		Medicines []string
+		Medicines []card
+		User      string
+		Age       time.Duration
 	}{
 		Medicines: medicines,
+		User:      user.Name,
+		Age:       snapshot.Age(),
 	}
 	if err = templates.List.Execute(w, data); err != nil {
 		http.Error(w, fmt.Sprintf("unable to execute template: %v", err), http.StatusInternalServerError)
@@ -103,7 +298,7 @@ func (h *MedicineHandler) medicineFor(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	slog.Info("selection", "vars", vars)
 
-	snapshot, err := h.getAll(r.Context())
+	snapshot, err := h.Store.Snapshot(r.Context())
 	if err != nil {
 		http.Error(w, fmt.Sprintf("unable to retrieve data: %v", err), http.StatusInternalServerError)
 		return
@@ -121,31 +316,412 @@ func (h *MedicineHandler) medicineFor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	canTake, reason, posology, waitFor := snapshot.CanTake(personName, medicineName)
+	_, blocked := snapshot.Violation(personName, medicineName, h.now(), true)
+	who := snapshot.GetPerson(personName)
+	weight, weighedAt := snapshot.Weight(personName, h.now())
+	var weightDose *models.WeightDose
+	if dose, ok := posology.DoseFor(weight); ok {
+		weightDose = &dose
+	}
+
+	recentDoses := make([]models.Dose, 0)
+	for i := len(snapshot.Events) - 1; i >= 0 && len(recentDoses) < 5; i-- {
+		if dose := snapshot.Events[i]; dose.Who == personName && dose.What == medicineName {
+			dose.When = dose.When.In(h.Location)
+			recentDoses = append(recentDoses, dose)
+		}
+	}
+
+	data := struct {
+		MedicineName   models.Medicine
+		Who            models.PersonCfg
+		Reason         string
+		CanTake        bool
+		Blocked        bool
+		Posology       models.PosologyEntry
+		WeightDose     *models.WeightDose
+		DailyMax       float64
+		Weight         float64
+		WeighedAt      time.Time
+		StaleWeight    bool
+		WaitForPct     float64
+		WaitFor        time.Duration
+		Age            time.Duration
+		CSRF           string
+		IdempotencyKey string
+		RecentDoses    []models.Dose
+		Now            string // Latest time the dose can be backdated to.
+	}{
+		MedicineName:   medicineName,
+		Who:            who,
+		Reason:         reason,
+		CanTake:        canTake,
+		Blocked:        blocked,
+		Posology:       posology,
+		WeightDose:     weightDose,
+		DailyMax:       posology.DailyMax(weight),
+		Weight:         weight,
+		WeighedAt:      weighedAt,
+		StaleWeight:    weighedAt.IsZero() || time.Since(weighedAt) > h.WeightMaxAge,
+		WaitForPct:     float64(waitFor) / float64(posology.DoseInterval),
+		WaitFor:        waitFor,
+		Age:            snapshot.Age(),
+		CSRF:           h.csrfToken(w, r),
+		IdempotencyKey: rand.Text(),
+		RecentDoses:    recentDoses,
+		Now:            h.now().Format(givenAtLayout),
+	}
+	if err = templates.MedicineFor.Execute(w, data); err != nil {
+		http.Error(w, fmt.Sprintf("unable to execute template: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// history lists the past doses of a person, for a single medicine when one is in the path.
+func (h *MedicineHandler) history(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	slog.Info("selection", "vars", vars)
+
+	snapshot, err := h.Store.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to retrieve data: %v", err), http.StatusInternalServerError)
+		return
+	}
+	medicineName := models.Medicine(vars["medicine"])
+	if medicineName != "" && !snapshot.HasMedicine(medicineName) {
+		http.Error(w, fmt.Sprintf("medicine %s not found", medicineName), http.StatusNotFound)
+		return
+	}
+
+	personName := models.Person(vars["person"])
+	if !snapshot.HasPerson(personName) {
+		http.Error(w, fmt.Sprintf("person %s not found", personName), http.StatusNotFound)
+		return
+	}
+
+	// The weight history is only shown on the page of the person.
+	weights := make([]models.WeightMeasurement, 0)
+	if medicineName == "" {
+		for i := len(snapshot.Weights) - 1; i >= 0; i-- {
+			if snapshot.Weights[i].Who == personName {
+				weights = append(weights, snapshot.Weights[i])
+			}
+		}
+		sort.SliceStable(weights, func(i, j int) bool { return weights[i].When.After(weights[j].When) })
+	}
+
+	records := snapshot.History(personName, medicineName)
+	for i := range records {
+		records[i].When = records[i].When.In(h.Location)
+	}
 
+	title := fmt.Sprintf("%s - history", personName)
+	if medicineName != "" {
+		title = fmt.Sprintf("%s - %s history", medicineName, personName)
+	}
 	data := struct {
+		Title        string
 		MedicineName models.Medicine
 		Who          models.PersonCfg
-		Reason       string
-		CanTake      bool
-		Posology     models.PosologyEntry
-		WaitForPct   float64
-		WaitFor      time.Duration
+		Records      []models.DoseRecord
+		Weights      []models.WeightMeasurement
+		Path         string
+		Age          time.Duration
+		CSRF         string
 	}{
+		Title:        title,
 		MedicineName: medicineName,
 		Who:          snapshot.GetPerson(personName),
-		Reason:       reason,
-		CanTake:      canTake,
-		Posology:     posology,
-		WaitForPct:   float64(waitFor) / float64(posology.DoseInterval),
-		WaitFor:      waitFor,
+		Records:      records,
+		Weights:      weights,
+		Path:         r.URL.Path,
+		Age:          snapshot.Age(),
+		CSRF:         h.csrfToken(w, r),
 	}
-	if err = templates.MedicineFor.Execute(w, data); err != nil {
+	if err = templates.History.Execute(w, data); err != nil {
+		http.Error(w, fmt.Sprintf("unable to execute template: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// plan helps alternating medicines, eg. paracetamol and ibuprofen, by showing which one comes next.
+func (h *MedicineHandler) plan(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	slog.Info("selection", "vars", vars)
+
+	snapshot, err := h.Store.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to retrieve data: %v", err), http.StatusInternalServerError)
+		return
+	}
+	personName := models.Person(vars["person"])
+	if !snapshot.HasPerson(personName) {
+		http.Error(w, fmt.Sprintf("person %s not found", personName), http.StatusNotFound)
+		return
+	}
+	selected := make([]models.Medicine, 0)
+	for _, name := range r.URL.Query()["medicine"] {
+		medicineName := models.Medicine(name)
+		if !snapshot.HasMedicine(medicineName) {
+			http.Error(w, fmt.Sprintf("medicine %s not found", medicineName), http.StatusNotFound)
+			return
+		}
+		selected = append(selected, medicineName)
+	}
+
+	type choice struct {
+		Name     models.Medicine
+		Selected bool
+	}
+	medicines := make([]choice, 0, len(snapshot.Medicines))
+	for medicineName := range snapshot.Medicines {
+		medicines = append(medicines, choice{Name: medicineName, Selected: slices.Contains(selected, medicineName)})
+	}
+	sort.Slice(medicines, func(i, j int) bool { return medicines[i].Name < medicines[j].Name })
+
+	type status struct {
+		Medicine models.Medicine
+		CanTake  bool
+		Reason   string
+		NextAt   time.Time
+	}
+	now := h.now()
+	statuses := make([]status, 0, len(selected))
+	for _, medicineName := range selected {
+		canTake, reason, _, _ := snapshot.CanTakeAt(personName, medicineName, now)
+		next, _ := snapshot.NextAllowed(personName, medicineName, now)
+		statuses = append(statuses, status{Medicine: medicineName, CanTake: canTake, Reason: reason, NextAt: next.In(h.Location)})
+	}
+	timeline := snapshot.Plan(personName, selected, now, 24*time.Hour)
+	for i := range timeline {
+		timeline[i].At = timeline[i].At.In(h.Location)
+	}
+
+	data := struct {
+		Who       models.PersonCfg
+		Medicines []choice
+		Statuses  []status
+		Timeline  []models.PlannedDose
+		Age       time.Duration
+	}{
+		Who:       snapshot.GetPerson(personName),
+		Medicines: medicines,
+		Statuses:  statuses,
+		Timeline:  timeline,
+		Age:       snapshot.Age(),
+	}
+	if err = templates.Plan.Execute(w, data); err != nil {
+		http.Error(w, fmt.Sprintf("unable to execute template: %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (h *MedicineHandler) prescriptions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	slog.Info("selection", "vars", vars)
+
+	snapshot, err := h.Store.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to retrieve data: %v", err), http.StatusInternalServerError)
+		return
+	}
+	personName := models.Person(vars["person"])
+	if !snapshot.HasPerson(personName) {
+		http.Error(w, fmt.Sprintf("person %s not found", personName), http.StatusNotFound)
+		return
+	}
+
+	type day struct {
+		Date  time.Time
+		Doses []models.ScheduledDose
+	}
+	type prescription struct {
+		models.Progress
+		Days []day
+	}
+	prescriptions := make([]prescription, 0)
+	for _, p := range snapshot.Prescriptions {
+		if p.Who != personName {
+			continue
+		}
+		progress, err := snapshot.Progress(p, h.now(), h.Location)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to follow the prescription of %s: %v", p.What, err), http.StatusInternalServerError)
+			return
+		}
+		days := make([]day, 0)
+		for _, scheduled := range progress.Schedule {
+			if len(days) == 0 || days[len(days)-1].Date.YearDay() != scheduled.At.YearDay() {
+				days = append(days, day{Date: scheduled.At})
+			}
+			days[len(days)-1].Doses = append(days[len(days)-1].Doses, scheduled)
+		}
+		prescriptions = append(prescriptions, prescription{Progress: progress, Days: days})
+	}
+
+	data := struct {
+		Who           models.PersonCfg
+		Prescriptions []prescription
+		Age           time.Duration
+	}{
+		Who:           snapshot.GetPerson(personName),
+		Prescriptions: prescriptions,
+		Age:           snapshot.Age(),
+	}
+	if err = templates.Prescriptions.Execute(w, data); err != nil {
+		http.Error(w, fmt.Sprintf("unable to execute template: %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (h *MedicineHandler) logWeight(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	snapshot, err := h.Store.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to retrieve data: %v", err), http.StatusInternalServerError)
+		return
+	}
+	personName := models.Person(vars["person"])
+	if !snapshot.HasPerson(personName) {
+		http.Error(w, fmt.Sprintf("person %s not found", personName), http.StatusNotFound)
+		return
+	}
+	if !h.validCSRF(r) {
+		http.Error(w, "invalid or missing CSRF token, reload the page and try again", http.StatusForbidden)
+		return
+	}
+
+	measurement := models.WeightMeasurement{Who: personName, Unit: r.PostFormValue("unit")}
+	if measurement.Value, err = strconv.ParseFloat(r.PostFormValue("weight"), 64); err != nil || measurement.Value <= 0 {
+		http.Error(w, fmt.Sprintf("invalid weight %q", r.PostFormValue("weight")), http.StatusBadRequest)
+		return
+	}
+	if _, err := measurement.Kg(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	today := h.now()
+	measurement.When = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	if date := r.PostFormValue("date"); date != "" {
+		if measurement.When, err = time.Parse(time.DateOnly, date); err != nil {
+			http.Error(w, fmt.Sprintf("invalid date %q", date), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := h.Store.LogWeight(r.Context(), measurement); err != nil {
+		http.Error(w, fmt.Sprintf("unable to log the weight of %s: %v", personName, err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/people/%s", personName), http.StatusSeeOther)
+}
+
+// observations charts the temperature of someone along with the doses they had, over the last few days.
+func (h *MedicineHandler) observations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	snapshot, err := h.Store.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to retrieve data: %v", err), http.StatusInternalServerError)
+		return
+	}
+	personName := models.Person(vars["person"])
+	if !snapshot.HasPerson(personName) {
+		http.Error(w, fmt.Sprintf("person %s not found", personName), http.StatusNotFound)
+		return
+	}
+	days := 3
+	if param := r.URL.Query().Get("days"); param != "" {
+		if days, err = strconv.Atoi(param); err != nil || days < 1 || days > 31 {
+			http.Error(w, fmt.Sprintf("invalid number of days %q", param), http.StatusBadRequest)
+			return
+		}
+	}
+
+	to := h.now()
+	from := to.AddDate(0, 0, -days)
+	observations := snapshot.ObservationsOf(personName, from, to)
+	for i := range observations {
+		observations[i].When = observations[i].When.In(h.Location)
+	}
+	doses := make([]models.Dose, 0)
+	for _, dose := range snapshot.Events {
+		if dose.Who == personName && !dose.When.Before(from) && !dose.When.After(to) {
+			doses = append(doses, dose)
+		}
+	}
+	chart := newTemperatureChart(observations, doses, from, to)
+	slices.Reverse(observations)
+
+	data := struct {
+		Who          models.PersonCfg
+		Chart        temperatureChart
+		Observations []models.Observation
+		CSRF         string
+		Age          time.Duration
+	}{
+		Who:          snapshot.GetPerson(personName),
+		Chart:        chart,
+		Observations: observations,
+		CSRF:         h.csrfToken(w, r),
+		Age:          snapshot.Age(),
+	}
+	if err = templates.Observations.Execute(w, data); err != nil {
 		http.Error(w, fmt.Sprintf("unable to execute template: %v", err), http.StatusInternalServerError)
 	}
 }
 
+func (h *MedicineHandler) logObservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	snapshot, err := h.Store.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to retrieve data: %v", err), http.StatusInternalServerError)
+		return
+	}
+	personName := models.Person(vars["person"])
+	if !snapshot.HasPerson(personName) {
+		http.Error(w, fmt.Sprintf("person %s not found", personName), http.StatusNotFound)
+		return
+	}
+	if !h.validCSRF(r) {
+		http.Error(w, "invalid or missing CSRF token, reload the page and try again", http.StatusForbidden)
+		return
+	}
+
+	observation := models.Observation{
+		Who:      personName,
+		When:     h.now(),
+		Symptoms: strings.TrimSpace(r.PostFormValue("symptoms")),
+		What:     models.Medicine(r.PostFormValue("medicine")),
+	}
+	if temperature := r.PostFormValue("temperature"); temperature != "" {
+		if observation.Temperature, err = strconv.ParseFloat(temperature, 64); err != nil {
+			http.Error(w, fmt.Sprintf("invalid temperature %q", temperature), http.StatusBadRequest)
+			return
+		}
+	}
+	if observation.What != "" && !snapshot.HasMedicine(observation.What) {
+		http.Error(w, fmt.Sprintf("medicine %s not found", observation.What), http.StatusNotFound)
+		return
+	}
+	if err := observation.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.LogObservation(r.Context(), observation); err != nil {
+		http.Error(w, fmt.Sprintf("unable to log the observation of %s: %v", personName, err), http.StatusInternalServerError)
+		return
+	}
+
+	next := auth.SafeNext(r.PostFormValue("next"), fmt.Sprintf("/people/%s/observations", personName))
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
 func (h *MedicineHandler) Register(r *mux.Router) {
-	r.HandleFunc("/{medicine}/{person}/take", h.take).Methods(http.MethodGet)
+	h.registerAPI(r)
+	r.HandleFunc("/doses/delete", h.deleteDose).Methods(http.MethodPost)
+	r.HandleFunc("/people/{person}", h.history).Methods(http.MethodGet)
+	r.HandleFunc("/people/{person}/weight", h.logWeight).Methods(http.MethodPost)
+	r.HandleFunc("/people/{person}/plan", h.plan).Methods(http.MethodGet)
+	r.HandleFunc("/people/{person}/prescriptions", h.prescriptions).Methods(http.MethodGet)
+	r.HandleFunc("/people/{person}/observations", h.observations).Methods(http.MethodGet)
+	r.HandleFunc("/people/{person}/observations", h.logObservation).Methods(http.MethodPost)
+	r.HandleFunc("/{medicine}/{person}/take", h.take).Methods(http.MethodPost)
+	r.HandleFunc("/{medicine}/{person}/history", h.history).Methods(http.MethodGet)
 	r.HandleFunc("/{medicine}/{person}", h.medicineFor).Methods(http.MethodGet)
 	r.HandleFunc("/{medicine}", h.medicineOverview).Methods(http.MethodGet)
 	r.HandleFunc("/", h.list).Methods(http.MethodGet)
@@ -0,0 +1,469 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nanassito/medicine/pkg/handlers"
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+type fakeStore struct {
+	snapshot models.Snapshot
+	logged   []models.Dose
+	deleted  []string
+	weights  []models.WeightMeasurement
+	observed []models.Observation
+}
+
+func (f *fakeStore) Snapshot(ctx context.Context) (models.Snapshot, error) {
+	return f.snapshot, nil
+}
+
+func (f *fakeStore) LogDose(ctx context.Context, dose models.Dose) error {
+	f.logged = append(f.logged, dose)
+	f.snapshot.AddDose(dose)
+	return nil
+}
+
+func (f *fakeStore) DeleteDose(ctx context.Context, key string, by string) error {
+	f.deleted = append(f.deleted, key)
+	return nil
+}
+
+func (f *fakeStore) LogWeight(ctx context.Context, measurement models.WeightMeasurement) error {
+	f.weights = append(f.weights, measurement)
+	return f.snapshot.AddWeight(measurement)
+}
+
+func (f *fakeStore) LogObservation(ctx context.Context, observation models.Observation) error {
+	f.observed = append(f.observed, observation)
+	f.snapshot.Observations = append(f.snapshot.Observations, observation)
+	return nil
+}
+
+func newTestRouter(t *testing.T, st *fakeStore) *mux.Router {
+	t.Helper()
+	handler, err := handlers.NewMedicineHandler(st)
+	if err != nil {
+		t.Fatalf("NewMedicineHandler() error = %v", err)
+	}
+	r := mux.NewRouter()
+	handler.Register(r)
+	return r
+}
+
+func testSnapshot() models.Snapshot {
+	return models.Snapshot{
+		People: models.PeopleSlice{
+			{Name: "John", Birth: time.Now().AddDate(-10, 0, 0)}, // 10 years old
+		},
+		Medicines: models.MedicinesMap{
+			"Aspirin": &models.MedicineCfg{
+				Posology: []models.PosologyEntry{
+					{OlderThan: 2 * 365 * 24 * time.Hour, Dose: "1 pill", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour},
+				},
+			},
+		},
+		Doses: models.DosesMap{},
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "List", path: "/", wantStatus: http.StatusOK, wantBody: "Aspirin"},
+		{name: "Overview", path: "/Aspirin", wantStatus: http.StatusOK, wantBody: "/Aspirin/John"},
+		{name: "Overview unknown medicine", path: "/Unknown", wantStatus: http.StatusNotFound},
+		{name: "Medicine for", path: "/Aspirin/John", wantStatus: http.StatusOK, wantBody: "they never had a dose"},
+		{name: "Medicine for unknown person", path: "/Aspirin/Jane", wantStatus: http.StatusNotFound},
+		{name: "History", path: "/Aspirin/John/history", wantStatus: http.StatusOK, wantBody: "No dose recorded yet"},
+		{name: "History unknown medicine", path: "/Unknown/John/history", wantStatus: http.StatusNotFound},
+		{name: "Person history", path: "/people/John", wantStatus: http.StatusOK, wantBody: "John - history"},
+		{name: "Person history unknown person", path: "/people/Jane", wantStatus: http.StatusNotFound},
+		{name: "Plan", path: "/people/John/plan?medicine=Aspirin", wantStatus: http.StatusOK, wantBody: "allowed now"},
+		{name: "Plan unknown medicine", path: "/people/John/plan?medicine=Unknown", wantStatus: http.StatusNotFound},
+		{name: "Prescriptions", path: "/people/John/prescriptions", wantStatus: http.StatusOK, wantBody: "No prescription"},
+		{name: "Observations", path: "/people/John/observations", wantStatus: http.StatusOK, wantBody: "No observation"},
+		{name: "Observations too far back", path: "/people/John/observations?days=365", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t, &fakeStore{snapshot: testSnapshot()})
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("GET %s status = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("GET %s body does not contain %q:\n%s", tt.path, tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestTimesInLocation(t *testing.T) {
+	location := time.FixedZone("UTC+5", 5*60*60)
+	when := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	snapshot := testSnapshot()
+	snapshot.AddDose(models.Dose{Who: "John", What: "Aspirin", When: when})
+	snapshot.Observations = []models.Observation{{Who: "John", When: when, Temperature: 38.5}}
+
+	handler, err := handlers.NewMedicineHandler(&fakeStore{snapshot: snapshot})
+	if err != nil {
+		t.Fatalf("NewMedicineHandler() error = %v", err)
+	}
+	handler.Location = location
+	r := mux.NewRouter()
+	handler.Register(r)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/Aspirin/John", want: when.In(location).Format("Mon 02 Jan 15:04")},
+		{path: "/Aspirin/John/history", want: when.In(location).Format("2006-01-02 15:04:05")},
+		{path: "/people/John/observations", want: when.In(location).Format("Mon 02 Jan 15:04")},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("GET %s body does not contain %q:\n%s", tt.path, tt.want, rec.Body.String())
+		}
+	}
+}
+
+func TestListStock(t *testing.T) {
+	snapshot := testSnapshot()
+	snapshot.Inventory = []models.StockItem{
+		{What: "Aspirin", Quantity: 3, Unit: "pill", Added: time.Now().AddDate(0, -1, 0), Expiry: time.Now().AddDate(1, 0, 0), LowAt: 4},
+		{What: "Aspirin", Quantity: 10, Unit: "pill", Added: time.Now().AddDate(-2, 0, 0), Expiry: time.Now().AddDate(0, 0, -1)},
+	}
+	r := newTestRouter(t, &fakeStore{snapshot: snapshot})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	for _, want := range []string{"Low stock", "Expired", "3 pill left"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET / body does not contain %q:\n%s", want, rec.Body.String())
+		}
+	}
+}
+
+var hiddenInput = regexp.MustCompile(`<input type="hidden" name="([^"]+)" value="([^"]*)">`)
+
+// takeForm loads a page and returns what its forms would submit along with the cookies it set.
+func takeForm(t *testing.T, r http.Handler, path string) (url.Values, []*http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %d, want %d", path, rec.Code, http.StatusOK)
+	}
+	form := url.Values{}
+	for _, match := range hiddenInput.FindAllStringSubmatch(rec.Body.String(), -1) {
+		form.Set(match[1], match[2])
+	}
+	return form, rec.Result().Cookies()
+}
+
+func postForm(r http.Handler, path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTake(t *testing.T) {
+	st := &fakeStore{snapshot: testSnapshot()}
+	r := newTestRouter(t, st)
+	form, cookies := takeForm(t, r, "/Aspirin/John")
+	rec := postForm(r, "/Aspirin/John/take", form, cookies)
+
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("take status = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	if len(st.logged) != 1 || st.logged[0].Who != "John" || st.logged[0].What != "Aspirin" {
+		t.Errorf("take logged %v, want a single dose of Aspirin for John", st.logged)
+	}
+}
+
+func TestTakeIsIdempotent(t *testing.T) {
+	st := &fakeStore{snapshot: testSnapshot()}
+	r := newTestRouter(t, st)
+	form, cookies := takeForm(t, r, "/Aspirin/John")
+	for range 2 {
+		if rec := postForm(r, "/Aspirin/John/take", form, cookies); rec.Code != http.StatusSeeOther {
+			t.Errorf("take status = %d, want %d", rec.Code, http.StatusSeeOther)
+		}
+	}
+	if len(st.logged) != 1 {
+		t.Errorf("take logged %d doses, want 1", len(st.logged))
+	}
+}
+
+func TestTakeRejectsForgedRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		tamper     func(form url.Values, cookies []*http.Cookie) (url.Values, []*http.Cookie)
+		wantStatus int
+	}{
+		{
+			name:       "GET",
+			method:     http.MethodGet,
+			tamper:     func(form url.Values, cookies []*http.Cookie) (url.Values, []*http.Cookie) { return form, cookies },
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "Missing token",
+			method: http.MethodPost,
+			tamper: func(form url.Values, cookies []*http.Cookie) (url.Values, []*http.Cookie) {
+				form.Del("csrf")
+				return form, cookies
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   "Missing cookie",
+			method: http.MethodPost,
+			tamper: func(form url.Values, cookies []*http.Cookie) (url.Values, []*http.Cookie) {
+				return form, nil
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   "Missing idempotency key",
+			method: http.MethodPost,
+			tamper: func(form url.Values, cookies []*http.Cookie) (url.Values, []*http.Cookie) {
+				form.Del("idempotency_key")
+				return form, cookies
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &fakeStore{snapshot: testSnapshot()}
+			r := newTestRouter(t, st)
+			form, cookies := tt.tamper(takeForm(t, r, "/Aspirin/John"))
+			var rec *httptest.ResponseRecorder
+			if tt.method == http.MethodGet {
+				rec = httptest.NewRecorder()
+				r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/Aspirin/John/take", nil))
+			} else {
+				rec = postForm(r, "/Aspirin/John/take", form, cookies)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("take status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if len(st.logged) != 0 {
+				t.Errorf("take logged %v, want nothing", st.logged)
+			}
+		})
+	}
+}
+
+func TestTakeRefused(t *testing.T) {
+	tests := []struct {
+		name         string
+		form         url.Values
+		wantStatus   int
+		wantOverride string
+	}{
+		{name: "Refused by default", form: url.Values{}, wantStatus: http.StatusConflict},
+		{name: "Override without a reason", form: url.Values{"override": {"1"}}, wantStatus: http.StatusConflict},
+		{name: "Override with a reason", form: url.Values{"override": {"1"}, "reason": {"doctor said so"}}, wantStatus: http.StatusSeeOther, wantOverride: "doctor said so"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := testSnapshot()
+			snapshot.Doses = models.DosesMap{"John": {"Aspirin": {time.Now().Add(-time.Hour)}}}
+			st := &fakeStore{snapshot: snapshot}
+			r := newTestRouter(t, st)
+			form, cookies := takeForm(t, r, "/Aspirin/John")
+			for k, v := range tt.form {
+				form[k] = v
+			}
+			rec := postForm(r, "/Aspirin/John/take", form, cookies)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("take status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantOverride == "" {
+				if len(st.logged) != 0 {
+					t.Errorf("take logged %v, want nothing", st.logged)
+				}
+				return
+			}
+			if len(st.logged) != 1 || !st.logged[0].Override || st.logged[0].OverrideReason != tt.wantOverride {
+				t.Errorf("take logged %v, want a single overridden dose because %q", st.logged, tt.wantOverride)
+			}
+		})
+	}
+}
+
+func TestTakeBackdated(t *testing.T) {
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+		wantAgo    time.Duration
+	}{
+		{name: "Before the last dose", form: url.Values{"ago": {"10h"}}, wantStatus: http.StatusSeeOther, wantAgo: 10 * time.Hour},
+		{name: "Too close to the last dose", form: url.Values{"ago": {"3h"}}, wantStatus: http.StatusConflict},
+		{name: "Overridden", form: url.Values{"ago": {"3h"}, "override": {"1"}, "reason": {"doctor said so"}}, wantStatus: http.StatusSeeOther, wantAgo: 3 * time.Hour},
+		{name: "At a time", form: url.Values{"when": {time.Now().Add(-10 * time.Hour).Format("2006-01-02T15:04")}}, wantStatus: http.StatusSeeOther, wantAgo: 10 * time.Hour},
+		{name: "In the future", form: url.Values{"when": {time.Now().Add(time.Hour).Format("2006-01-02T15:04")}}, wantStatus: http.StatusBadRequest},
+		{name: "Invalid duration", form: url.Values{"ago": {"-1h"}}, wantStatus: http.StatusBadRequest},
+		{name: "Both ago and a time", form: url.Values{"ago": {"1h"}, "when": {time.Now().Add(-10 * time.Hour).Format("2006-01-02T15:04")}}, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := testSnapshot()
+			snapshot.AddDose(models.Dose{Who: "John", What: "Aspirin", When: time.Now().Add(-time.Hour)})
+			st := &fakeStore{snapshot: snapshot}
+			r := newTestRouter(t, st)
+			form, cookies := takeForm(t, r, "/Aspirin/John")
+			for k, v := range tt.form {
+				form[k] = v
+			}
+			rec := postForm(r, "/Aspirin/John/take", form, cookies)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("take status = %d, want %d\n%s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantAgo == 0 {
+				if len(st.logged) != 0 {
+					t.Errorf("take logged %v, want nothing", st.logged)
+				}
+				return
+			}
+			if len(st.logged) != 1 || time.Since(st.logged[0].When).Round(time.Hour) != tt.wantAgo {
+				t.Errorf("take logged %v, want a single dose given %v ago", st.logged, tt.wantAgo)
+			}
+		})
+	}
+}
+
+func TestMedicineForWeightDose(t *testing.T) {
+	snapshot := testSnapshot()
+	snapshot.People[0].Weight = 13
+	snapshot.Medicines["Paracetamol"] = &models.MedicineCfg{Posology: []models.PosologyEntry{
+		{PerKg: 15, Concentration: 24, Graduation: 0.25, DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour},
+	}}
+	r := newTestRouter(t, &fakeStore{snapshot: snapshot})
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/Paracetamol/John", nil))
+	if want := "8.25 mL (198 mg)"; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("GET /Paracetamol/John body does not contain %q:\n%s", want, rec.Body.String())
+	}
+}
+
+func TestLogWeight(t *testing.T) {
+	st := &fakeStore{snapshot: testSnapshot()}
+	r := newTestRouter(t, st)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/Aspirin/John", nil))
+	if want := "was never measured"; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("GET /Aspirin/John body does not contain %q:\n%s", want, rec.Body.String())
+	}
+
+	form, cookies := takeForm(t, r, "/people/John")
+	form.Set("weight", "31.5")
+	form.Set("unit", "kg")
+	form.Set("date", time.Now().Format(time.DateOnly))
+	if rec := postForm(r, "/people/John/weight", form, cookies); rec.Code != http.StatusSeeOther {
+		t.Fatalf("log weight status = %d, want %d\n%s", rec.Code, http.StatusSeeOther, rec.Body.String())
+	}
+	if len(st.weights) != 1 || st.weights[0].Value != 31.5 {
+		t.Errorf("logged weights %v, want a single measurement of 31.5kg", st.weights)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/Aspirin/John", nil))
+	if strings.Contains(rec.Body.String(), "the posology may not fit anymore") {
+		t.Errorf("GET /Aspirin/John still warns about the weight after logging one:\n%s", rec.Body.String())
+	}
+
+	form.Set("unit", "stone")
+	if rec := postForm(r, "/people/John/weight", form, cookies); rec.Code != http.StatusBadRequest {
+		t.Errorf("log weight in stones status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestTakeBlocked(t *testing.T) {
+	snapshot := testSnapshot()
+	snapshot.Contraindications = []models.Contraindication{{Who: "John", What: "Aspirin", Reason: "allergic"}}
+	st := &fakeStore{snapshot: snapshot}
+	r := newTestRouter(t, st)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/Aspirin/John", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "Aspirin is contraindicated for them: allergic") || strings.Contains(body, "/Aspirin/John/take") {
+		t.Errorf("GET /Aspirin/John doesn't block the Take button:\n%s", body)
+	}
+
+	form, cookies := takeForm(t, r, "/people/John") // The Take form is gone, borrow the CSRF token from another page.
+	form.Set("idempotency_key", "abc")
+	form.Set("override", "1")
+	form.Set("reason", "doctor said so")
+	rec = postForm(r, "/Aspirin/John/take", form, cookies)
+	if rec.Code != http.StatusConflict || strings.Contains(rec.Body.String(), "Give it anyway") {
+		t.Errorf("overriding a contraindication = %d, want %d without an override form:\n%s", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+	if len(st.logged) != 0 {
+		t.Errorf("logged %v, want nothing", st.logged)
+	}
+}
+
+func TestLogObservation(t *testing.T) {
+	st := &fakeStore{snapshot: testSnapshot()}
+	r := newTestRouter(t, st)
+
+	form, cookies := takeForm(t, r, "/Aspirin/John")
+	form.Set("temperature", "38.7")
+	form.Set("symptoms", "cough")
+	rec := postForm(r, "/people/John/observations", form, cookies)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/Aspirin/John" {
+		t.Fatalf("log observation status = %d to %q, want %d to /Aspirin/John\n%s", rec.Code, rec.Header().Get("Location"), http.StatusSeeOther, rec.Body.String())
+	}
+	if len(st.observed) != 1 || st.observed[0].Temperature != 38.7 || st.observed[0].What != "Aspirin" {
+		t.Errorf("logged observations %v, want 38.7°C along with Aspirin", st.observed)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/people/John/observations", nil))
+	if want := "38.7°C at"; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("GET /people/John/observations body does not contain %q:\n%s", want, rec.Body.String())
+	}
+
+	for _, temperature := range []string{"101", "hot", ""} {
+		form.Set("temperature", temperature)
+		form.Set("symptoms", "")
+		if rec := postForm(r, "/people/John/observations", form, cookies); rec.Code != http.StatusBadRequest {
+			t.Errorf("log a temperature of %q status = %d, want %d", temperature, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nanassito/medicine/pkg/auth"
+)
+
+// Households serves several households from the same deployment, eg. the grandparents' own sheet.
+// Each one has its own store and handler so their data never mix, the household of a request
+// is the one of the logged in user.
+type Households struct {
+	routers map[string]http.Handler
+}
+
+func NewHouseholds() *Households {
+	return &Households{routers: make(map[string]http.Handler)}
+}
+
+// Add serves a household with its own handler. It needs a name, the users without a household
+// would see its data otherwise.
+func (h *Households) Add(name string, handler *MedicineHandler) error {
+	if name == "" {
+		return errors.New("a household needs a name")
+	}
+	if _, ok := h.routers[name]; ok {
+		return fmt.Errorf("household %s is listed twice", name)
+	}
+	r := mux.NewRouter()
+	handler.Register(r)
+	h.routers[name] = r
+	return nil
+}
+
+// CheckUsers makes sure the household of each user is served, eg. to catch a typo in the config.
+func (h *Households) CheckUsers(users []auth.User) error {
+	for _, user := range users {
+		if _, ok := h.routers[user.Household]; !ok {
+			return fmt.Errorf("%s is part of household %q, which isn't served", user.Name, user.Household)
+		}
+	}
+	return nil
+}
+
+func (h *Households) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "log in to find out your household", http.StatusUnauthorized)
+		return
+	}
+	router, ok := h.routers[user.Household]
+	if !ok {
+		slog.Warn("user outside of any household", "user", user.Name, "household", user.Household)
+		http.Error(w, fmt.Sprintf("%s isn't part of any household", user.Name), http.StatusForbidden)
+		return
+	}
+	router.ServeHTTP(w, r)
+}
@@ -0,0 +1,81 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nanassito/medicine/pkg/auth"
+	"github.com/nanassito/medicine/pkg/handlers"
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+func TestHouseholds(t *testing.T) {
+	grandparents := testSnapshot()
+	grandparents.People = models.PeopleSlice{{Name: "Grandpa", Birth: time.Now().AddDate(-70, 0, 0)}}
+	served := handlers.NewHouseholds()
+	for name, snapshot := range map[string]models.Snapshot{"home": testSnapshot(), "grandparents": grandparents} {
+		handler, err := handlers.NewMedicineHandler(&fakeStore{snapshot: snapshot})
+		if err != nil {
+			t.Fatalf("NewMedicineHandler() error = %v", err)
+		}
+		if err := served.Add(name, handler); err != nil {
+			t.Fatalf("Add(%s) error = %v", name, err)
+		}
+	}
+	authenticator, err := auth.NewAuthenticator(auth.Config{
+		Users: []auth.User{
+			{Name: "Alice", Role: auth.RoleCaregiver, Household: "home"},
+			{Name: "Granny", Role: auth.RoleCaregiver, Household: "grandparents"},
+		},
+		Header: "X-Forwarded-User",
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+	root := authenticator.Middleware(served)
+
+	tests := []struct {
+		user       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{user: "Alice", path: "/Aspirin", wantStatus: http.StatusOK, wantBody: "/Aspirin/John"},
+		{user: "Alice", path: "/Aspirin/Grandpa", wantStatus: http.StatusNotFound},
+		{user: "Granny", path: "/Aspirin", wantStatus: http.StatusOK, wantBody: "/Aspirin/Grandpa"},
+		{user: "Granny", path: "/Aspirin/John", wantStatus: http.StatusNotFound},
+		{user: "Carol", path: "/Aspirin", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("X-Forwarded-User", tt.user)
+			rec := httptest.NewRecorder()
+			root.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("GET %s as %s status = %d, want %d", tt.path, tt.user, rec.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("GET %s as %s body does not contain %q:\n%s", tt.path, tt.user, tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+
+	if err := served.Add("home", nil); err == nil {
+		t.Errorf("Add(home) twice error = nil, want an error")
+	}
+	if err := served.Add("", nil); err == nil {
+		t.Errorf("Add() without a name error = nil, want an error")
+	}
+	if err := served.CheckUsers(authenticator.Config.Users); err != nil {
+		t.Errorf("CheckUsers() error = %v", err)
+	}
+	for _, user := range []auth.User{{Name: "Bob"}, {Name: "Carol", Household: "hom"}} {
+		if err := served.CheckUsers([]auth.User{user}); err == nil {
+			t.Errorf("CheckUsers() with %s in household %q error = nil, want an error", user.Name, user.Household)
+		}
+	}
+}
@@ -2,7 +2,11 @@ package models
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -10,6 +14,7 @@ var (
 	ErrMedicineNotFound = errors.New("<error: medicine not found>")
 	ErrPersonNotFound   = errors.New("<error: person not found>")
 	ErrTooYoung         = errors.New("they are too young")
+	ErrNoPosology       = errors.New("no posology matches their age and weight")
 )
 
 type PeopleSlice []PersonCfg
@@ -18,10 +23,74 @@ type DosesMap map[Person]map[Medicine][]time.Time
 
 type MedicinesMap map[Medicine]*MedicineCfg
 
+// Snapshot is shared between concurrent requests, it must be treated as read only.
 type Snapshot struct {
 	People    PeopleSlice
 	Doses     DosesMap
+	Events    []Dose // Every dose that wasn't deleted, in the order they were logged.
 	Medicines MedicinesMap
+	Weights   []WeightMeasurement // Only the measurements in a known unit.
+	// Rules that forbid a dose whatever the posology says.
+	Interactions      []Interaction
+	Contraindications []Contraindication
+	Prescriptions     []Prescription
+	Inventory         []StockItem
+	Observations      []Observation
+	FetchedAt         time.Time
+}
+
+// AddDose is used while loading the snapshot, deleted doses are skipped.
+func (s *Snapshot) AddDose(dose Dose) {
+	if dose.Deleted() {
+		return
+	}
+	s.Events = append(s.Events, dose)
+	if s.Doses == nil {
+		s.Doses = make(DosesMap)
+	}
+	if _, ok := s.Doses[dose.Who]; !ok {
+		s.Doses[dose.Who] = make(map[Medicine][]time.Time)
+	}
+	s.Doses[dose.Who][dose.What] = append(s.Doses[dose.Who][dose.What], dose.When)
+}
+
+// AddWeight is used while loading the snapshot, measurements in an unknown unit are an error.
+func (s *Snapshot) AddWeight(measurement WeightMeasurement) error {
+	if _, err := measurement.Kg(); err != nil {
+		return fmt.Errorf("invalid weight for %s on %s: %v", measurement.Who, measurement.When.Format(time.DateOnly), err)
+	}
+	s.Weights = append(s.Weights, measurement)
+	return nil
+}
+
+// Weight returns the weight of someone in kg as of a given time, along with when it was measured.
+// It falls back on the weight of the people tab when nothing was logged before then, the time is then zero.
+func (s *Snapshot) Weight(person Person, at time.Time) (weight float64, measured time.Time) {
+	for _, measurement := range s.Weights {
+		if measurement.Who != person || measurement.When.After(at) || measurement.When.Before(measured) {
+			continue
+		}
+		weight, _ = measurement.Kg()
+		measured = measurement.When
+	}
+	if measured.IsZero() {
+		return float64(s.GetPerson(person).Weight), measured
+	}
+	return weight, measured
+}
+
+func (s *Snapshot) GetDose(key string) (Dose, bool) {
+	for _, dose := range s.Events {
+		if dose.Key() == key {
+			return dose, true
+		}
+	}
+	return Dose{}, false
+}
+
+// Age tells how stale the data is.
+func (s *Snapshot) Age() time.Duration {
+	return time.Since(s.FetchedAt).Round(time.Second)
 }
 
 func (s *Snapshot) HasMedicine(medicine Medicine) bool {
@@ -48,56 +117,264 @@ func (s *Snapshot) GetPerson(person Person) PersonCfg {
 }
 
 func (s *Snapshot) CanTake(who Person, what Medicine) (canTake bool, reason string, posology PosologyEntry, waitFor time.Duration) {
-	posology, err := s.GetPosology(who, what)
-	waitFor = time.Duration(0)
-	reason = "This is a bug"
-	canTake = false
+	return s.CanTakeAt(who, what, time.Now())
+}
 
+// CanTakeAt tells whether a dose could be taken at a given time, doses logged after then are ignored.
+func (s *Snapshot) CanTakeAt(who Person, what Medicine, at time.Time) (canTake bool, reason string, posology PosologyEntry, waitFor time.Duration) {
+	posology, err := s.GetPosologyAt(who, what, at)
 	if err != nil {
-		reason = err.Error()
 		// If the person is too young or there is some missing data we'll get an error.
-		return
+		return false, err.Error(), posology, 0
 	}
 
-	// This person never had a dose so it's fine.
-	if _, ok := s.Doses[who][what]; !ok {
-		canTake = true
+	previous := s.dosesBefore(who, what, at, true)
+
+	// Ok now we know the person can generally take this medicine.
+	// Let's check if they haven't over done it.
+	canTake = true
+	reason = "they haven't had a dose in a while"
+	if len(previous) == 0 {
 		reason = "they never had a dose"
-		return
 	}
+	tooSoon, tooMany, waitFor := posology.check(previous, at)
+	if tooSoon {
+		canTake = false
+		reason = "their last dose is too recent"
+	}
+	if tooMany {
+		canTake = false
+		reason = "they had too many doses recently"
+	}
+	if over, limit, wait := s.overDailyMax(who, posology, at, true); over && wait <= 0 {
+		weight, _ := s.Weight(who, at)
+		canTake = false
+		reason = fmt.Sprintf("a single dose of %s mg is above the daily maximum of %s mg of %s", formatMg(posology.Amount(weight)), formatMg(limit), posology.Ingredient)
+	} else if over {
+		canTake = false
+		reason = fmt.Sprintf("they would take more than %s mg of %s over 24h", formatMg(limit), posology.Ingredient)
+		waitFor = max(waitFor, wait)
+	}
+	if violation, ok := s.Violation(who, what, at, true); ok {
+		canTake = false
+		reason = violation.Reason
+		waitFor = max(waitFor, violation.WaitFor)
+	}
+	return canTake, reason, posology, waitFor
+}
 
-	doses := []time.Time{}
-	sort.Slice(s.Doses[who][what], func(i, j int) bool {
+// BreaksLater tells whether a dose given at a past time would make one of the doses logged after it break the
+// posology or a rule, eg. when a dose given at night is only logged in the morning after another one.
+// The record is the first such dose, as it would be once the backdated one is counted.
+func (s *Snapshot) BreaksLater(who Person, what Medicine, at time.Time) (DoseRecord, bool) {
+	respected := make(map[string]bool)
+	for _, record := range s.History(who, "") {
+		respected[record.Key()] = record.Respected()
+	}
+	sim := s.clone()
+	sim.AddDose(Dose{Who: who, What: what, When: at})
+	records := sim.History(who, "")
+	for i := len(records) - 1; i >= 0; i-- {
+		if record := records[i]; record.When.After(at) && respected[record.Key()] && !record.Respected() {
+			return record, true
+		}
+	}
+	return DoseRecord{}, false
+}
+
+// Violation is an interaction or contraindication rule forbidding a dose. Unlike the posology, it can't be overridden.
+type Violation struct {
+	Reason  string
+	WaitFor time.Duration // Zero for a contraindication, it never goes away.
+}
+
+// Violation tells whether a dose given at a given time would break an interaction or contraindication rule.
+func (s *Snapshot) Violation(who Person, what Medicine, at time.Time, inclusive bool) (violation Violation, ok bool) {
+	for _, rule := range s.Contraindications {
+		if rule.Who == who && s.refersTo(who, what, at, rule.What) {
+			violation.Reason = fmt.Sprintf("%s is contraindicated for them", what)
+			if rule.Reason != "" {
+				violation.Reason += ": " + rule.Reason
+			}
+			return violation, true
+		}
+	}
+
+	for _, rule := range s.Interactions {
+		for _, pair := range [][2]string{{rule.Medicine, rule.Other}, {rule.Other, rule.Medicine}} {
+			if !s.refersTo(who, what, at, pair[0]) {
+				continue
+			}
+			for _, dose := range s.Events {
+				if dose.Who != who || dose.What == what || dose.When.After(at) || (!inclusive && dose.When.Equal(at)) {
+					continue
+				}
+				if at.Sub(dose.When) >= rule.Within || !s.refersTo(who, dose.What, dose.When, pair[1]) {
+					continue
+				}
+				if wait := rule.Within - at.Sub(dose.When); wait > violation.WaitFor {
+					violation.WaitFor = wait
+					violation.Reason = fmt.Sprintf("%s must not be given within %v of %s", what, rule.Within, dose.What)
+					if rule.Note != "" {
+						violation.Reason += ": " + rule.Note
+					}
+					ok = true
+				}
+			}
+		}
+	}
+	return violation, ok
+}
+
+// refersTo tells whether a rule naming a medicine or an active ingredient applies to a medicine.
+func (s *Snapshot) refersTo(who Person, what Medicine, at time.Time, name string) bool {
+	if strings.EqualFold(string(what), name) {
+		return true
+	}
+	entry, err := s.GetPosologyAt(who, what, at)
+	return err == nil && entry.Ingredient != "" && strings.EqualFold(entry.Ingredient, name)
+}
+
+// overDailyMax tells whether a dose given at a given time would take someone over the daily maximum of its
+// ingredient, counting every product that contains it. It also tells how long until the dose would be fine,
+// which is never when the dose alone is above the maximum: waitFor is 0 then.
+func (s *Snapshot) overDailyMax(who Person, posology PosologyEntry, at time.Time, inclusive bool) (over bool, limit float64, waitFor time.Duration) {
+	weight, _ := s.Weight(who, at)
+	limit = posology.DailyMax(weight)
+	if limit == 0 {
+		return false, 0, 0
+	}
+
+	type intake struct {
+		when   time.Time
+		amount float64
+	}
+	intakes := make([]intake, 0)
+	total := posology.Amount(weight)
+	if total > limit {
+		return true, limit, 0
+	}
+	for _, dose := range s.Events {
+		if dose.Who != who || dose.When.After(at) || (!inclusive && dose.When.Equal(at)) || !dose.When.After(at.Add(-24*time.Hour)) {
+			continue
+		}
+		entry, err := s.GetPosologyAt(who, dose.What, dose.When)
+		if err != nil || !strings.EqualFold(entry.Ingredient, posology.Ingredient) {
+			continue
+		}
+		doseWeight, _ := s.Weight(who, dose.When)
+		intakes = append(intakes, intake{when: dose.When, amount: entry.Amount(doseWeight)})
+		total += intakes[len(intakes)-1].amount
+	}
+	if total <= limit {
+		return false, limit, 0
+	}
+
+	// Wait for the oldest doses to be more than 24h old.
+	sort.Slice(intakes, func(i, j int) bool { return intakes[i].when.Before(intakes[j].when) })
+	for _, taken := range intakes {
+		total -= taken.amount
+		waitFor = taken.when.Add(24 * time.Hour).Sub(at)
+		if total <= limit {
+			break
+		}
+	}
+	return true, limit, waitFor
+}
+
+// formatMg drops the useless decimals, eg. 4000 rather than 4000.000000.
+func formatMg(mg float64) string {
+	return strconv.FormatFloat(mg, 'f', -1, 64)
+}
+
+// dosesBefore returns the doses taken before a given time, sorted from most recent to oldest.
+func (s *Snapshot) dosesBefore(who Person, what Medicine, at time.Time, inclusive bool) []time.Time {
+	doses := make([]time.Time, 0)
+	for _, dose := range s.Doses[who][what] {
+		if dose.Before(at) || (inclusive && dose.Equal(at)) {
+			doses = append(doses, dose)
+		}
+	}
+	sort.Slice(doses, func(i, j int) bool {
 		// Sort from most recent to oldest
-		return s.Doses[who][what][i].After(s.Doses[who][what][j])
+		return doses[i].After(doses[j])
 	})
-	for _, dose := range s.Doses[who][what] {
-		if dose.After(time.Now().Add(-posology.MaxDosesInterval)) {
+	return doses
+}
+
+// check evaluates a dose taken at a given time against the previous doses, sorted from most recent to oldest.
+func (p PosologyEntry) check(previous []time.Time, at time.Time) (tooSoon, tooMany bool, waitFor time.Duration) {
+	doses := []time.Time{}
+	for _, dose := range previous {
+		if dose.After(at.Add(-p.MaxDosesInterval)) {
 			doses = append(doses, dose)
 		}
 	}
-	// Ok now we know the person can generally take this medicine.
-	// Let's check if they haven't over done it.
-	canTake = true
-	reason = "they haven't had a dose in a while"
 
-	if len(doses) > 0 && time.Since(doses[0]) <= posology.DoseInterval {
-		canTake = false
-		reason = "their last dose is too recent"
-		waitFor = posology.DoseInterval - time.Since(doses[0])
+	// The dose is allowed again right when the interval is over, so that the wait is never zero when refused.
+	if len(doses) > 0 && at.Sub(doses[0]) < p.DoseInterval {
+		tooSoon = true
+		waitFor = p.DoseInterval - at.Sub(doses[0])
 	}
 
-	if len(doses) > 0 && len(doses) >= int(posology.MaxDoses) {
-		canTake = false
-		reason = "they had too many doses recently"
-		oldestRelevantDose := doses[int(posology.MaxDoses)-1]
-		waitFor = max(waitFor, posology.MaxDosesInterval-time.Since(oldestRelevantDose))
+	if len(doses) > 0 && p.MaxDoses > 0 && len(doses) >= int(p.MaxDoses) {
+		tooMany = true
+		oldestRelevantDose := doses[int(p.MaxDoses)-1]
+		waitFor = max(waitFor, p.MaxDosesInterval-at.Sub(oldestRelevantDose))
 	}
 
-	return
+	return tooSoon, tooMany, waitFor
+}
+
+// DoseRecord is a past dose along with the posology that applied at the time and whether it was respected.
+type DoseRecord struct {
+	Dose
+	Posology      PosologyEntry
+	PosologyError string // Why no posology applied, eg. they were too young.
+	TooSoon       bool   // It was given less than DoseInterval after the previous one.
+	TooMany       bool   // It went over MaxDoses within MaxDosesInterval.
+	TooMuch       bool   // It went over the daily maximum of its ingredient.
+	Violation     string // The interaction or contraindication rule it broke.
+}
+
+func (r DoseRecord) Respected() bool {
+	return r.PosologyError == "" && !r.TooSoon && !r.TooMany && !r.TooMuch && r.Violation == ""
+}
+
+// History lists the doses someone had of a medicine, or of every medicine when `what` is empty,
+// from the most recent to the oldest.
+func (s *Snapshot) History(who Person, what Medicine) []DoseRecord {
+	records := make([]DoseRecord, 0)
+	for _, dose := range s.Events {
+		if dose.Who != who || (what != "" && dose.What != what) {
+			continue
+		}
+		record := DoseRecord{Dose: dose}
+		posology, err := s.GetPosologyAt(who, dose.What, dose.When)
+		if err != nil {
+			record.PosologyError = err.Error()
+		} else {
+			record.Posology = posology
+			record.TooSoon, record.TooMany, _ = posology.check(s.dosesBefore(who, dose.What, dose.When, false), dose.When)
+			record.TooMuch, _, _ = s.overDailyMax(who, posology, dose.When, false)
+		}
+		if violation, ok := s.Violation(who, dose.What, dose.When, false); ok {
+			record.Violation = violation.Reason
+		}
+		records = append(records, record)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].When.After(records[j].When)
+	})
+	return records
 }
 
 func (s *Snapshot) GetPosology(personName Person, medicineName Medicine) (PosologyEntry, error) {
+	return s.GetPosologyAt(personName, medicineName, time.Now())
+}
+
+// GetPosologyAt finds the posology that applies given the age the person has at a given time.
+func (s *Snapshot) GetPosologyAt(personName Person, medicineName Medicine, at time.Time) (PosologyEntry, error) {
 	medicine, ok := s.Medicines[medicineName]
 	if !ok {
 		return PosologyEntry{}, ErrMedicineNotFound
@@ -112,18 +389,107 @@ func (s *Snapshot) GetPosology(personName Person, medicineName Medicine) (Posolo
 		return PosologyEntry{}, ErrPersonNotFound
 	}
 
-	sort.Slice(medicine.Posology, func(i, j int) bool {
-		if medicine.Posology[i].OlderThan == medicine.Posology[j].OlderThan {
-			return medicine.Posology[i].HeavierThan > medicine.Posology[j].HeavierThan
+	posology := slices.Clone(medicine.Posology)
+	sort.Slice(posology, func(i, j int) bool {
+		if posology[i].OlderThan == posology[j].OlderThan {
+			return posology[i].HeavierThan > posology[j].HeavierThan
 		}
-		return medicine.Posology[i].OlderThan > medicine.Posology[j].OlderThan
+		return posology[i].OlderThan > posology[j].OlderThan
 	})
 
-	for _, entry := range medicine.Posology {
-		if time.Since(person.Birth) >= entry.OlderThan || (person.Weight >= entry.HeavierThan && entry.HeavierThan > 0) {
+	age := at.Sub(person.Birth)
+	weight, _ := s.Weight(personName, at)
+	tooYoung := true
+	for _, entry := range posology {
+		if entry.Matches(age, weight) {
 			return entry, nil
 		}
+		if age >= entry.OlderThan {
+			tooYoung = false
+		}
+	}
+
+	if tooYoung {
+		return PosologyEntry{}, ErrTooYoung
 	}
+	return PosologyEntry{}, ErrNoPosology
+}
 
-	return PosologyEntry{}, ErrTooYoung
+// NextAllowed tells when someone may next take a medicine, from a given time on.
+// It's false when nothing but a change of data would allow it, eg. they are too young.
+func (s *Snapshot) NextAllowed(who Person, what Medicine, from time.Time) (time.Time, bool) {
+	at := from
+	// Several rules may take turns refusing, eg. the interval then the daily maximum.
+	for range 10 {
+		canTake, _, _, waitFor := s.CanTakeAt(who, what, at)
+		if canTake {
+			return at, true
+		}
+		if waitFor <= 0 {
+			return time.Time{}, false
+		}
+		at = at.Add(waitFor)
+	}
+	return time.Time{}, false
+}
+
+// PlannedDose is a dose suggested by Plan.
+type PlannedDose struct {
+	Medicine Medicine
+	At       time.Time
+	Dose     string
+}
+
+// Plan suggests when to give each of the medicines over the horizon, eg. to alternate paracetamol and ibuprofen.
+// Every dose is given as soon as it's allowed, preferring the medicine that was given the longest ago.
+func (s *Snapshot) Plan(who Person, medicines []Medicine, from time.Time, horizon time.Duration) []PlannedDose {
+	sim := s.clone()
+	plan := make([]PlannedDose, 0)
+	at := from
+	for len(plan) < 100 {
+		var next PlannedDose
+		var nextLast time.Time
+		for _, medicine := range medicines {
+			allowed, ok := sim.NextAllowed(who, medicine, at)
+			if !ok || allowed.After(from.Add(horizon)) {
+				continue
+			}
+			last := sim.lastDose(who, medicine)
+			if next.Medicine == "" || allowed.Before(next.At) || (allowed.Equal(next.At) && last.Before(nextLast)) {
+				posology, _ := sim.GetPosologyAt(who, medicine, allowed)
+				next = PlannedDose{Medicine: medicine, At: allowed, Dose: posology.Dose}
+				nextLast = last
+			}
+		}
+		if next.Medicine == "" {
+			break
+		}
+		plan = append(plan, next)
+		sim.AddDose(Dose{Who: who, What: next.Medicine, When: next.At})
+		at = next.At
+	}
+	return plan
+}
+
+func (s *Snapshot) lastDose(who Person, what Medicine) (last time.Time) {
+	for _, dose := range s.Doses[who][what] {
+		if dose.After(last) {
+			last = dose
+		}
+	}
+	return last
+}
+
+// clone copies what AddDose modifies so the copy can be changed without affecting a shared snapshot.
+func (s *Snapshot) clone() Snapshot {
+	clone := *s
+	clone.Events = slices.Clone(s.Events)
+	clone.Doses = make(DosesMap, len(s.Doses))
+	for person, medicines := range s.Doses {
+		clone.Doses[person] = make(map[Medicine][]time.Time, len(medicines))
+		for medicine, doses := range medicines {
+			clone.Doses[person][medicine] = slices.Clone(doses)
+		}
+	}
+	return clone
 }
@@ -190,3 +190,423 @@ func TestCanTake(t *testing.T) {
 		})
 	}
 }
+
+func TestHistory(t *testing.T) {
+	birth := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(day, hour int) time.Time { return time.Date(2024, 1, day, hour, 0, 0, 0, time.UTC) }
+	adult := models.PosologyEntry{OlderThan: 2 * 365 * 24 * time.Hour, Dose: "1 pill", DoseInterval: 6 * time.Hour, MaxDoses: 2, MaxDosesInterval: 24 * time.Hour}
+	snapshot := models.Snapshot{
+		People: models.PeopleSlice{{Name: "John", Birth: birth}},
+		Medicines: models.MedicinesMap{
+			"Aspirin":   &models.MedicineCfg{Posology: []models.PosologyEntry{adult}},
+			"Ibuprofen": &models.MedicineCfg{Posology: []models.PosologyEntry{{OlderThan: 20 * 365 * 24 * time.Hour}}},
+		},
+	}
+	for _, dose := range []models.Dose{
+		{Who: "John", What: "Aspirin", When: at(1, 8)},
+		{Who: "John", What: "Aspirin", When: at(1, 10)}, // Only 2h after the previous one.
+		{Who: "John", What: "Aspirin", When: at(1, 20)}, // Third dose within 24h.
+		{Who: "John", What: "Aspirin", When: at(3, 8)},
+		{Who: "John", What: "Ibuprofen", When: at(2, 8)}, // He is too young.
+		{Who: "Jane", What: "Aspirin", When: at(1, 9)},
+	} {
+		snapshot.AddDose(dose)
+	}
+
+	tests := []struct {
+		name     string
+		medicine models.Medicine
+		want     []models.DoseRecord
+	}{
+		{
+			name:     "Single medicine",
+			medicine: "Aspirin",
+			want: []models.DoseRecord{
+				{Dose: models.Dose{Who: "John", What: "Aspirin", When: at(3, 8)}, Posology: adult},
+				{Dose: models.Dose{Who: "John", What: "Aspirin", When: at(1, 20)}, Posology: adult, TooMany: true},
+				{Dose: models.Dose{Who: "John", What: "Aspirin", When: at(1, 10)}, Posology: adult, TooSoon: true},
+				{Dose: models.Dose{Who: "John", What: "Aspirin", When: at(1, 8)}, Posology: adult},
+			},
+		},
+		{
+			name: "Every medicine",
+			want: []models.DoseRecord{
+				{Dose: models.Dose{Who: "John", What: "Aspirin", When: at(3, 8)}, Posology: adult},
+				{Dose: models.Dose{Who: "John", What: "Ibuprofen", When: at(2, 8)}, PosologyError: models.ErrTooYoung.Error()},
+				{Dose: models.Dose{Who: "John", What: "Aspirin", When: at(1, 20)}, Posology: adult, TooMany: true},
+				{Dose: models.Dose{Who: "John", What: "Aspirin", When: at(1, 10)}, Posology: adult, TooSoon: true},
+				{Dose: models.Dose{Who: "John", What: "Aspirin", When: at(1, 8)}, Posology: adult},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, snapshot.History("John", tt.medicine)); diff != "" {
+				t.Errorf("History() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBreaksLater(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2024, 1, 2, hour, 0, 0, 0, time.UTC) }
+	posology := models.PosologyEntry{Dose: "1 pill", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour}
+	snapshot := models.Snapshot{
+		People: models.PeopleSlice{{Name: "John", Birth: time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)}},
+		Medicines: models.MedicinesMap{
+			"Aspirin": &models.MedicineCfg{Posology: []models.PosologyEntry{posology}},
+			"Advil":   &models.MedicineCfg{Posology: []models.PosologyEntry{posology}},
+		},
+		Interactions: []models.Interaction{{Medicine: "Advil", Other: "Aspirin", Within: 4 * time.Hour}},
+	}
+	snapshot.AddDose(models.Dose{Who: "John", What: "Aspirin", When: at(8)})
+
+	tests := []struct {
+		name          string
+		medicine      models.Medicine
+		at            time.Time
+		want          bool
+		wantViolation bool
+	}{
+		{name: "Long before", medicine: "Aspirin", at: at(1)},
+		{name: "Too close to the next dose", medicine: "Aspirin", at: at(4), want: true},
+		{name: "After every dose", medicine: "Aspirin", at: at(9)},
+		{name: "Interaction with the next dose", medicine: "Advil", at: at(6), want: true, wantViolation: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, got := snapshot.BreaksLater("John", tt.medicine, tt.at)
+			if got != tt.want {
+				t.Fatalf("BreaksLater() = %v, want %v", got, tt.want)
+			}
+			if got && (!record.When.Equal(at(8)) || (record.Violation != "") != tt.wantViolation) {
+				t.Errorf("BreaksLater() record = %+v, want the dose at 8 with a violation %v", record, tt.wantViolation)
+			}
+		})
+	}
+	if len(snapshot.Events) != 1 {
+		t.Errorf("BreaksLater() changed the snapshot, events = %v", snapshot.Events)
+	}
+}
+
+func TestGetPosology(t *testing.T) {
+	const year = 365 * 24 * time.Hour
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	toddler := models.PosologyEntry{OlderThan: 1 * year, YoungerThan: 6 * year, Dose: "toddler"}
+	heavyChild := models.PosologyEntry{HeavierThan: 20, LighterThan: 40, Match: models.MatchWeight, Dose: "20-40kg"}
+	child := models.PosologyEntry{OlderThan: 6 * year, HeavierThan: 20, Match: models.MatchAll, Dose: "child"}
+	adult := models.PosologyEntry{OlderThan: 15 * year, Match: models.MatchAge, HeavierThan: 50, Dose: "adult"}
+	legacy := models.PosologyEntry{OlderThan: 12 * year, HeavierThan: 40, Match: models.MatchAny, Dose: "12y or 40kg"}
+
+	tests := []struct {
+		name     string
+		age      time.Duration
+		weight   int64
+		posology []models.PosologyEntry
+		want     models.PosologyEntry
+		wantErr  error
+	}{
+		{name: "Age only by default", age: 3 * year, posology: []models.PosologyEntry{toddler}, want: toddler},
+		{name: "Heavy toddler doesn't get the adult dose", age: 3 * year, weight: 80, posology: []models.PosologyEntry{toddler, adult}, want: toddler},
+		{name: "Over the maximum age", age: 7 * year, weight: 10, posology: []models.PosologyEntry{toddler, child}, wantErr: models.ErrNoPosology},
+		{name: "Both age and weight", age: 7 * year, weight: 25, posology: []models.PosologyEntry{toddler, child}, want: child},
+		{name: "Old enough but too light", age: 7 * year, weight: 15, posology: []models.PosologyEntry{child}, wantErr: models.ErrNoPosology},
+		{name: "Weight only", age: 2 * year, weight: 30, posology: []models.PosologyEntry{heavyChild}, want: heavyChild},
+		{name: "Over the maximum weight", age: 2 * year, weight: 45, posology: []models.PosologyEntry{heavyChild}, wantErr: models.ErrNoPosology},
+		{name: "Age rule ignores the weight", age: 20 * year, weight: 30, posology: []models.PosologyEntry{child, adult}, want: adult},
+		{name: "Any rule by age", age: 13 * year, weight: 30, posology: []models.PosologyEntry{legacy}, want: legacy},
+		{name: "Any rule by weight", age: 8 * year, weight: 45, posology: []models.PosologyEntry{legacy}, want: legacy},
+		{name: "Any rule without either", age: 8 * year, weight: 30, posology: []models.PosologyEntry{legacy}, wantErr: models.ErrTooYoung},
+		{name: "Too young for every entry", age: 6 * 30 * 24 * time.Hour, posology: []models.PosologyEntry{toddler, child}, wantErr: models.ErrTooYoung},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := models.Snapshot{
+				People:    models.PeopleSlice{{Name: "John", Birth: at.Add(-tt.age), Weight: tt.weight}},
+				Medicines: models.MedicinesMap{"Aspirin": &models.MedicineCfg{Posology: tt.posology}},
+			}
+			got, err := snapshot.GetPosologyAt("John", "Aspirin", at)
+			if err != tt.wantErr || got != tt.want {
+				t.Errorf("GetPosologyAt() = (%v, %v), want (%v, %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPosologyEntryValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   models.PosologyEntry
+		wantErr bool
+	}{
+		{name: "Defaults", entry: models.PosologyEntry{}},
+		{name: "Bounds", entry: models.PosologyEntry{OlderThan: time.Hour, YoungerThan: 2 * time.Hour, HeavierThan: 10, LighterThan: 20, Match: models.MatchWeight}},
+		{name: "Unknown rule", entry: models.PosologyEntry{Match: "or"}, wantErr: true},
+		{name: "Inverted ages", entry: models.PosologyEntry{OlderThan: 2 * time.Hour, YoungerThan: time.Hour}, wantErr: true},
+		{name: "Inverted weights", entry: models.PosologyEntry{HeavierThan: 20, LighterThan: 10}, wantErr: true},
+		{name: "Ingredient with a strength", entry: models.PosologyEntry{Ingredient: "paracetamol", Strength: 500}},
+		{name: "Ingredient with a weight based dose", entry: models.PosologyEntry{Ingredient: "paracetamol", PerKg: 15}},
+		{name: "Ingredient without an amount", entry: models.PosologyEntry{Ingredient: "paracetamol"}, wantErr: true},
+		{name: "Dose within the daily maximum", entry: models.PosologyEntry{Ingredient: "paracetamol", Strength: 1000, MaxDaily: 4000}},
+		{name: "Dose above the daily maximum", entry: models.PosologyEntry{Ingredient: "paracetamol", Strength: 1000, MaxDaily: 500}, wantErr: true},
+		{name: "Weight based dose and daily maximum", entry: models.PosologyEntry{Ingredient: "paracetamol", PerKg: 15, MaxDaily: 500}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.entry.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWeight(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	snapshot := models.Snapshot{People: models.PeopleSlice{{Name: "John", Weight: 10}}}
+	for _, measurement := range []models.WeightMeasurement{
+		{Who: "John", When: day(10), Value: 12000, Unit: "g"},
+		{Who: "John", When: day(5), Value: 11},
+		{Who: "Jane", When: day(7), Value: 50},
+	} {
+		if err := snapshot.AddWeight(measurement); err != nil {
+			t.Fatalf("AddWeight() error = %v", err)
+		}
+	}
+	if err := snapshot.AddWeight(models.WeightMeasurement{Who: "John", When: day(1), Value: 1, Unit: "stone"}); err == nil {
+		t.Errorf("AddWeight() with an unknown unit error = nil, want an error")
+	}
+
+	tests := []struct {
+		name         string
+		at           time.Time
+		wantWeight   float64
+		wantMeasured time.Time
+	}{
+		{name: "Before any measurement", at: day(1), wantWeight: 10},
+		{name: "Between measurements", at: day(7), wantWeight: 11, wantMeasured: day(5)},
+		{name: "Latest measurement", at: day(20), wantWeight: 12, wantMeasured: day(10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weight, measured := snapshot.Weight("John", tt.at)
+			if weight != tt.wantWeight || !measured.Equal(tt.wantMeasured) {
+				t.Errorf("Weight() = (%v, %v), want (%v, %v)", weight, measured, tt.wantWeight, tt.wantMeasured)
+			}
+		})
+	}
+}
+
+func TestCanTakeDailyIngredientMax(t *testing.T) {
+	at := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	syrup := models.PosologyEntry{Dose: "5 mL", Ingredient: "paracetamol", PerKg: 15, MaxDailyPerKg: 60, DoseInterval: 4 * time.Hour, MaxDoses: 6, MaxDosesInterval: 24 * time.Hour}
+	suppository := models.PosologyEntry{Dose: "1", Ingredient: "Paracetamol", Strength: 200, MaxDaily: 1000, DoseInterval: 4 * time.Hour, MaxDoses: 6, MaxDosesInterval: 24 * time.Hour}
+	ibuprofen := models.PosologyEntry{Dose: "5 mL", Ingredient: "ibuprofen", Strength: 100, DoseInterval: 6 * time.Hour, MaxDoses: 3, MaxDosesInterval: 24 * time.Hour}
+	concentrate := models.PosologyEntry{Dose: "1 mL", Ingredient: "paracetamol", PerKg: 15, MaxDaily: 100, DoseInterval: 4 * time.Hour, MaxDoses: 6, MaxDosesInterval: 24 * time.Hour}
+
+	tests := []struct {
+		name        string
+		doses       []models.Dose
+		medicine    models.Medicine
+		wantResult  bool
+		wantMsg     string
+		wantWaitFor time.Duration
+	}{
+		{
+			name:       "Under the maximum",
+			doses:      []models.Dose{{What: "Syrup", When: at.Add(-10 * time.Hour)}},
+			medicine:   "Suppository",
+			wantResult: true,
+			wantMsg:    "they never had a dose",
+		},
+		{
+			// 3 x 150 mg of syrup + 200 mg is fine, but the syrup alone limits at 60 mg/kg, ie. 600 mg.
+			name: "Over the maximum across products",
+			doses: []models.Dose{
+				{What: "Syrup", When: at.Add(-20 * time.Hour)},
+				{What: "Suppository", When: at.Add(-16 * time.Hour)},
+				{What: "Syrup", When: at.Add(-12 * time.Hour)},
+				{What: "Syrup", When: at.Add(-8 * time.Hour)},
+			},
+			medicine:    "Syrup",
+			wantResult:  false,
+			wantMsg:     "they would take more than 600 mg of paracetamol over 24h",
+			wantWaitFor: 8 * time.Hour, // Both the first syrup and the suppository must be over 24h old.
+		},
+		{
+			name: "Doses older than 24h don't count",
+			doses: []models.Dose{
+				{What: "Syrup", When: at.Add(-30 * time.Hour)},
+				{What: "Syrup", When: at.Add(-26 * time.Hour)},
+				{What: "Suppository", When: at.Add(-25 * time.Hour)},
+				{What: "Syrup", When: at.Add(-8 * time.Hour)},
+			},
+			medicine:   "Syrup",
+			wantResult: true,
+			wantMsg:    "they haven't had a dose in a while",
+		},
+		{
+			name: "Other ingredients don't count",
+			doses: []models.Dose{
+				{What: "Ibuprofen", When: at.Add(-20 * time.Hour)},
+				{What: "Ibuprofen", When: at.Add(-12 * time.Hour)},
+				{What: "Suppository", When: at.Add(-8 * time.Hour)},
+			},
+			medicine:   "Suppository",
+			wantResult: true,
+			wantMsg:    "they haven't had a dose in a while",
+		},
+		{
+			// 15 mg/kg at 10 kg, waiting doesn't help.
+			name:       "Single dose over the maximum",
+			medicine:   "Concentrate",
+			wantResult: false,
+			wantMsg:    "a single dose of 150 mg is above the daily maximum of 100 mg of paracetamol",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := models.Snapshot{
+				People: models.PeopleSlice{{Name: "John", Birth: at.AddDate(-4, 0, 0), Weight: 10}},
+				Medicines: models.MedicinesMap{
+					"Syrup":       &models.MedicineCfg{Posology: []models.PosologyEntry{syrup}},
+					"Suppository": &models.MedicineCfg{Posology: []models.PosologyEntry{suppository}},
+					"Ibuprofen":   &models.MedicineCfg{Posology: []models.PosologyEntry{ibuprofen}},
+					"Concentrate": &models.MedicineCfg{Posology: []models.PosologyEntry{concentrate}},
+				},
+			}
+			for _, dose := range tt.doses {
+				dose.Who = "John"
+				snapshot.AddDose(dose)
+			}
+			gotResult, gotMsg, _, waitFor := snapshot.CanTakeAt("John", tt.medicine, at)
+			if gotResult != tt.wantResult || gotMsg != tt.wantMsg || waitFor != tt.wantWaitFor {
+				t.Errorf("CanTakeAt() = (%v, %v, %v), want (%v, %v, %v)", gotResult, gotMsg, waitFor, tt.wantResult, tt.wantMsg, tt.wantWaitFor)
+			}
+		})
+	}
+}
+
+func TestCanTakeRules(t *testing.T) {
+	at := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	posology := models.PosologyEntry{Dose: "1 pill", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour}
+	withIngredient := posology
+	withIngredient.Ingredient = "ibuprofen"
+
+	tests := []struct {
+		name              string
+		interactions      []models.Interaction
+		contraindications []models.Contraindication
+		doses             []models.Dose
+		medicine          models.Medicine
+		wantResult        bool
+		wantMsg           string
+		wantWaitFor       time.Duration
+	}{
+		{
+			name:         "Interaction",
+			interactions: []models.Interaction{{Medicine: "Advil", Other: "Aspirin", Within: 8 * time.Hour, Note: "it reduces the effect of aspirin"}},
+			doses:        []models.Dose{{What: "Aspirin", When: at.Add(-3 * time.Hour)}},
+			medicine:     "Advil",
+			wantMsg:      "Advil must not be given within 8h0m0s of Aspirin: it reduces the effect of aspirin",
+			wantWaitFor:  5 * time.Hour,
+		},
+		{
+			name:         "Interaction the other way round",
+			interactions: []models.Interaction{{Medicine: "Aspirin", Other: "Advil", Within: 8 * time.Hour}},
+			doses:        []models.Dose{{What: "Aspirin", When: at.Add(-3 * time.Hour)}},
+			medicine:     "Advil",
+			wantMsg:      "Advil must not be given within 8h0m0s of Aspirin",
+			wantWaitFor:  5 * time.Hour,
+		},
+		{
+			name:         "Interaction by ingredient",
+			interactions: []models.Interaction{{Medicine: "Ibuprofen", Other: "aspirin", Within: 8 * time.Hour}},
+			doses:        []models.Dose{{What: "Aspirin", When: at.Add(-3 * time.Hour)}},
+			medicine:     "Advil",
+			wantMsg:      "Advil must not be given within 8h0m0s of Aspirin",
+			wantWaitFor:  5 * time.Hour,
+		},
+		{
+			name:         "Interaction expired",
+			interactions: []models.Interaction{{Medicine: "Advil", Other: "Aspirin", Within: 8 * time.Hour}},
+			doses:        []models.Dose{{What: "Aspirin", When: at.Add(-9 * time.Hour)}},
+			medicine:     "Advil",
+			wantResult:   true,
+			wantMsg:      "they never had a dose",
+		},
+		{
+			name:              "Contraindication",
+			contraindications: []models.Contraindication{{Who: "John", What: "ibuprofen", Reason: "allergic"}},
+			medicine:          "Advil",
+			wantMsg:           "Advil is contraindicated for them: allergic",
+		},
+		{
+			name:              "Contraindication for someone else",
+			contraindications: []models.Contraindication{{Who: "Jane", What: "Advil"}},
+			medicine:          "Advil",
+			wantResult:        true,
+			wantMsg:           "they never had a dose",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := models.Snapshot{
+				People: models.PeopleSlice{{Name: "John", Birth: at.AddDate(-10, 0, 0)}},
+				Medicines: models.MedicinesMap{
+					"Aspirin": &models.MedicineCfg{Posology: []models.PosologyEntry{posology}},
+					"Advil":   &models.MedicineCfg{Posology: []models.PosologyEntry{withIngredient}},
+				},
+				Interactions:      tt.interactions,
+				Contraindications: tt.contraindications,
+			}
+			for _, dose := range tt.doses {
+				dose.Who = "John"
+				snapshot.AddDose(dose)
+			}
+			gotResult, gotMsg, _, waitFor := snapshot.CanTakeAt("John", tt.medicine, at)
+			if gotResult != tt.wantResult || gotMsg != tt.wantMsg || waitFor != tt.wantWaitFor {
+				t.Errorf("CanTakeAt() = (%v, %v, %v), want (%v, %v, %v)", gotResult, gotMsg, waitFor, tt.wantResult, tt.wantMsg, tt.wantWaitFor)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	from := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	snapshot := models.Snapshot{
+		People: models.PeopleSlice{{Name: "John", Birth: from.AddDate(-4, 0, 0)}},
+		Medicines: models.MedicinesMap{
+			"Paracetamol": &models.MedicineCfg{Posology: []models.PosologyEntry{{Dose: "5 mL", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour}}},
+			"Ibuprofen":   &models.MedicineCfg{Posology: []models.PosologyEntry{{Dose: "7 mL", DoseInterval: 8 * time.Hour, MaxDoses: 2, MaxDosesInterval: 24 * time.Hour}}},
+			"Aspirin":     &models.MedicineCfg{Posology: []models.PosologyEntry{{OlderThan: 15 * 365 * 24 * time.Hour}}},
+		},
+		// Stagger them so they aren't given at the same time.
+		Interactions: []models.Interaction{{Medicine: "Paracetamol", Other: "Ibuprofen", Within: 3 * time.Hour}},
+	}
+	snapshot.AddDose(models.Dose{Who: "John", What: "Paracetamol", When: from.Add(-2 * time.Hour)})
+
+	got := snapshot.Plan("John", []models.Medicine{"Paracetamol", "Ibuprofen", "Aspirin"}, from, 24*time.Hour)
+	want := []models.PlannedDose{
+		{Medicine: "Ibuprofen", At: from.Add(time.Hour), Dose: "7 mL"},
+		{Medicine: "Paracetamol", At: from.Add(4 * time.Hour), Dose: "5 mL"},
+		{Medicine: "Ibuprofen", At: from.Add(9 * time.Hour), Dose: "7 mL"},
+		{Medicine: "Paracetamol", At: from.Add(12 * time.Hour), Dose: "5 mL"},
+		{Medicine: "Paracetamol", At: from.Add(18 * time.Hour), Dose: "5 mL"},
+		{Medicine: "Paracetamol", At: from.Add(24 * time.Hour), Dose: "5 mL"}, // Right at the end of the horizon.
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Plan() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, ok := snapshot.NextAllowed("John", "Aspirin", from); ok {
+		t.Errorf("NextAllowed() for a medicine they are too young for = true, want false")
+	}
+	if len(snapshot.Events) != 1 {
+		t.Errorf("Plan() changed the snapshot, it has %d events", len(snapshot.Events))
+	}
+}
@@ -1,34 +1,251 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"time"
 )
 
 type Person string
 type Medicine string
 
+// MatchRule tells which of the age and weight bounds of a posology entry someone must be within for it to apply.
+type MatchRule string
+
+const (
+	MatchAll    MatchRule = "all"    // Both the age and the weight, this is the default.
+	MatchAge    MatchRule = "age"    // Only the age, the weight bounds are ignored.
+	MatchWeight MatchRule = "weight" // Only the weight, the age bounds are ignored.
+	MatchAny    MatchRule = "any"    // Either the age or the weight, a weight without bounds doesn't count.
+)
+
 type PosologyEntry struct {
 	HeavierThan      int64         `sheet:"Minimum Weight"`
 	OlderThan        time.Duration `sheet:"Minimum Age"`
+	LighterThan      int64         `sheet:"Maximum Weight,optional"` // 0 means no upper bound.
+	YoungerThan      time.Duration `sheet:"Maximum Age,optional"`    // 0 means no upper bound.
+	Match            MatchRule     `sheet:"Match,optional"`
 	Dose             string        `sheet:"Dose"`
 	DoseInterval     time.Duration `sheet:"Dose interval"`
 	MaxDoses         int64         `sheet:"Max doses"`
 	MaxDosesInterval time.Duration `sheet:"Interval"`
+	// When set the dose is computed from the weight, see DoseFor.
+	PerKg         float64 `sheet:"mg/kg,optional"`
+	Concentration float64 `sheet:"Concentration,optional"`   // mg per mL of the product.
+	MaxSingleDose float64 `sheet:"Max single dose,optional"` // mg, 0 means no limit.
+	Graduation    float64 `sheet:"Graduation,optional"`      // mL between two marks of the syringe, 0.1 when empty.
+	// Products sharing an active ingredient count towards the same daily maximum, see DailyMax.
+	Ingredient    string  `sheet:"Ingredient,optional"`
+	Strength      float64 `sheet:"Strength,optional"`        // mg of Ingredient in one dose, unless the dose is weight based.
+	MaxDaily      float64 `sheet:"Max daily mg,optional"`    // mg of Ingredient over 24h, 0 means no limit.
+	MaxDailyPerKg float64 `sheet:"Max daily mg/kg,optional"` // Same but proportional to the weight.
+}
+
+// DailyMax is the most of its ingredient someone of that weight in kg may take over 24h, in mg.
+// It's the lowest of the limits that are set, 0 when there is none.
+func (p PosologyEntry) DailyMax(weight float64) float64 {
+	limit := p.MaxDaily
+	if perKg := p.MaxDailyPerKg * weight; perKg > 0 && (limit == 0 || perKg < limit) {
+		limit = perKg
+	}
+	return limit
+}
+
+// Amount is how much of its ingredient a dose contains for someone of that weight in kg, in mg.
+func (p PosologyEntry) Amount(weight float64) float64 {
+	if dose, ok := p.DoseFor(weight); ok {
+		return dose.Amount
+	}
+	return p.Strength
+}
+
+// Consumes is how much of a product counted in that unit a dose takes for someone of that weight in kg.
+// Units other than mg and mL count the doses, eg. pills. It's false when the posology doesn't tell,
+// eg. the volume of a dose when the concentration is unknown.
+func (p PosologyEntry) Consumes(weight float64, unit string) (float64, bool) {
+	switch strings.ToLower(unit) {
+	case "mg":
+		amount := p.Amount(weight)
+		return amount, amount > 0
+	case "ml":
+		if dose, ok := p.DoseFor(weight); ok && dose.Volume > 0 {
+			return dose.Volume, true
+		}
+		if p.Strength > 0 && p.Concentration > 0 {
+			return p.Strength / p.Concentration, true
+		}
+		return 0, false
+	default:
+		return 1, true
+	}
+}
+
+// WeightDose is a dose computed from someone's weight.
+type WeightDose struct {
+	Weight float64 // kg
+	Amount float64 // mg
+	Volume float64 // mL, zero when the concentration of the product is unknown.
+	Capped bool    // The computed dose was above MaxSingleDose.
+}
+
+// DoseFor computes the dose for someone of that weight, it's false when the entry isn't weight based.
+// The volume is rounded to the syringe graduation, but never above the maximum single dose.
+func (p PosologyEntry) DoseFor(weight float64) (WeightDose, bool) {
+	if p.PerKg <= 0 || weight <= 0 {
+		return WeightDose{}, false
+	}
+	dose := WeightDose{Weight: weight, Amount: p.PerKg * weight}
+	if p.MaxSingleDose > 0 && dose.Amount > p.MaxSingleDose {
+		dose.Amount = p.MaxSingleDose
+		dose.Capped = true
+	}
+	if p.Concentration <= 0 {
+		return dose, true
+	}
+
+	graduation := p.Graduation
+	if graduation <= 0 {
+		graduation = 0.1
+	}
+	marks := math.Round(dose.Amount / p.Concentration / graduation)
+	if p.MaxSingleDose > 0 && marks*graduation*p.Concentration > p.MaxSingleDose {
+		marks = math.Floor(p.MaxSingleDose / p.Concentration / graduation)
+	}
+	// Multiplying again avoids the float noise, eg. 8.100000000000001 mL.
+	dose.Volume = math.Round(marks*graduation*1000) / 1000
+	dose.Amount = math.Round(dose.Volume*p.Concentration*1000) / 1000
+	return dose, true
+}
+
+// Validate catches the mistakes in a posology entry that would make it apply to the wrong people.
+func (p PosologyEntry) Validate() error {
+	switch p.Match {
+	case "", MatchAll, MatchAge, MatchWeight, MatchAny:
+	default:
+		return fmt.Errorf("unknown match rule %q, want one of %s, %s, %s or %s", p.Match, MatchAll, MatchAge, MatchWeight, MatchAny)
+	}
+	if p.YoungerThan != 0 && p.YoungerThan <= p.OlderThan {
+		return fmt.Errorf("maximum age %v isn't above the minimum age %v", p.YoungerThan, p.OlderThan)
+	}
+	if p.PerKg < 0 || p.Concentration < 0 || p.MaxSingleDose < 0 || p.Graduation < 0 {
+		return errors.New("the weight based dose can't be negative")
+	}
+	if p.Strength < 0 || p.MaxDaily < 0 || p.MaxDailyPerKg < 0 {
+		return errors.New("the strength and daily maximums can't be negative")
+	}
+	if (p.MaxDaily > 0 || p.MaxDailyPerKg > 0) && p.Ingredient == "" {
+		return errors.New("a daily maximum needs an ingredient")
+	}
+	// It would count as 0 mg towards the daily maximum of its ingredient otherwise.
+	if p.Ingredient != "" && p.Strength <= 0 && p.PerKg <= 0 {
+		return fmt.Errorf("the strength or mg/kg of %s is needed to count it towards its daily maximum", p.Ingredient)
+	}
+	// A fixed dose above the daily maximum could never be given, weight based ones are checked when given.
+	if p.PerKg <= 0 && p.MaxDaily > 0 && p.Strength > p.MaxDaily {
+		return fmt.Errorf("a dose of %s mg is above the daily maximum of %s mg of %s", formatMg(p.Strength), formatMg(p.MaxDaily), p.Ingredient)
+	}
+	if p.LighterThan != 0 && p.LighterThan <= p.HeavierThan {
+		return fmt.Errorf("maximum weight %d isn't above the minimum weight %d", p.LighterThan, p.HeavierThan)
+	}
+	return nil
+}
+
+// Matches tells whether the entry applies to someone of that age and weight in kg.
+func (p PosologyEntry) Matches(age time.Duration, weight float64) bool {
+	ageOk := age >= p.OlderThan && (p.YoungerThan == 0 || age < p.YoungerThan)
+	weightOk := weight >= float64(p.HeavierThan) && (p.LighterThan == 0 || weight < float64(p.LighterThan))
+	switch p.Match {
+	case MatchAge:
+		return ageOk
+	case MatchWeight:
+		return weightOk
+	case MatchAny:
+		return ageOk || (weightOk && (p.HeavierThan > 0 || p.LighterThan > 0))
+	default:
+		return ageOk && weightOk
+	}
 }
 
 type PersonCfg struct {
 	Name     Person    `sheet:"Name"`
 	Birth    time.Time `sheet:"Birthdate"`
-	Weight   int64     `sheet:"Weight"`
+	Weight   int64     `sheet:"Weight"` // kg, only used until a measurement is logged in the weight history.
 	PhotoUrl string    `sheet:"Photo"`
 }
 
+// WeightMeasurement is an entry of the weight history of someone.
+type WeightMeasurement struct {
+	Who   Person    `sheet:"Person"`
+	When  time.Time `sheet:"Date"`
+	Value float64   `sheet:"Weight"`
+	Unit  string    `sheet:"Unit,optional"` // kg when empty, g or lb otherwise.
+}
+
+// Kg converts the measurement to kilograms.
+func (w WeightMeasurement) Kg() (float64, error) {
+	switch strings.ToLower(w.Unit) {
+	case "", "kg":
+		return w.Value, nil
+	case "g":
+		return w.Value / 1000, nil
+	case "lb", "lbs":
+		return w.Value * 0.45359237, nil
+	default:
+		return 0, fmt.Errorf("unknown weight unit %q", w.Unit)
+	}
+}
+
 type MedicineCfg struct {
 	Posology []PosologyEntry
 }
 
 type Dose struct {
-	Who  Person    `sheet:"Person"`
-	What Medicine  `sheet:"Medicine"`
-	When time.Time `sheet:"When,2006-01-02 15:04:05"`
+	ID             string    `sheet:"ID,optional"`
+	Who            Person    `sheet:"Person"`
+	What           Medicine  `sheet:"Medicine"`
+	When           time.Time `sheet:"When,2006-01-02 15:04:05"`
+	Override       bool      `sheet:"Override,optional"`        // The caregiver gave it even though CanTake said no.
+	OverrideReason string    `sheet:"Override reason,optional"` // Why they did.
+	GivenBy        string    `sheet:"Given by,optional"`        // The caregiver who logged it.
+	DeletedAt      time.Time `sheet:"Deleted at,2006-01-02 15:04:05,optional"`
+	DeletedBy      string    `sheet:"Deleted by,optional"`
+}
+
+// Key identifies a dose, rows added by hand in the sheet don't have an ID so they are identified by their content.
+func (d Dose) Key() string {
+	if d.ID != "" {
+		return d.ID
+	}
+	return fmt.Sprintf("%s|%s|%s", d.Who, d.What, d.When.UTC().Format(time.DateTime))
+}
+
+// Deleted tells whether the dose was undone, deleted doses are kept as tombstones for the record.
+func (d Dose) Deleted() bool {
+	return !d.DeletedAt.IsZero()
+}
+
+// Interaction forbids giving Medicine within some time of Other, either way round.
+// Both can name a medicine or an active ingredient.
+type Interaction struct {
+	Medicine string        `sheet:"Medicine"`
+	Other    string        `sheet:"Other"`
+	Within   time.Duration `sheet:"Within"`
+	Note     string        `sheet:"Note,optional"`
+}
+
+// Contraindication forbids giving a medicine, or any product with that active ingredient, to someone.
+type Contraindication struct {
+	Who    Person `sheet:"Person"`
+	What   string `sheet:"Medicine"`
+	Reason string `sheet:"Reason,optional"` // eg. allergic.
+}
+
+// AuditEntry records who did what, eg. who deleted a dose.
+type AuditEntry struct {
+	When    time.Time `sheet:"When,2006-01-02 15:04:05"`
+	Who     string    `sheet:"Who"`
+	Action  string    `sheet:"Action"`
+	Details string    `sheet:"Details"`
 }
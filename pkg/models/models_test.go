@@ -0,0 +1,40 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+func TestDoseFor(t *testing.T) {
+	// Paediatric paracetamol syrup, 15 mg/kg at 24 mg/mL.
+	paracetamol := models.PosologyEntry{PerKg: 15, Concentration: 24, MaxSingleDose: 1000, Graduation: 0.25}
+	tests := []struct {
+		name   string
+		entry  models.PosologyEntry
+		weight float64
+		want   models.WeightDose
+		wantOk bool
+	}{
+		{name: "Not weight based", entry: models.PosologyEntry{Dose: "1 pill"}, weight: 13},
+		{name: "Unknown weight", entry: paracetamol},
+		{name: "Rounded to the graduation", entry: paracetamol, weight: 13, want: models.WeightDose{Weight: 13, Amount: 198, Volume: 8.25}, wantOk: true},
+		{name: "Default graduation", entry: models.PosologyEntry{PerKg: 15, Concentration: 24}, weight: 13, want: models.WeightDose{Weight: 13, Amount: 194.4, Volume: 8.1}, wantOk: true},
+		{name: "Capped", entry: paracetamol, weight: 80, want: models.WeightDose{Weight: 80, Amount: 996, Volume: 41.5, Capped: true}, wantOk: true},
+		{name: "Rounding doesn't go over the cap", entry: models.PosologyEntry{PerKg: 15, Concentration: 24, MaxSingleDose: 190, Graduation: 0.5}, weight: 13, want: models.WeightDose{Weight: 13, Amount: 180, Volume: 7.5, Capped: true}, wantOk: true},
+		{name: "Unknown concentration", entry: models.PosologyEntry{PerKg: 15}, weight: 13, want: models.WeightDose{Weight: 13, Amount: 195}, wantOk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.entry.DoseFor(tt.weight)
+			if ok != tt.wantOk {
+				t.Fatalf("DoseFor() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("DoseFor() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
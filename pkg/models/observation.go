@@ -0,0 +1,45 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Observation records how someone is doing, eg. their temperature when they are given a fever medicine.
+type Observation struct {
+	Who         Person    `sheet:"Person"`
+	When        time.Time `sheet:"When,2006-01-02 15:04:05"`
+	Temperature float64   `sheet:"Temperature,optional"` // °C, 0 when it wasn't taken.
+	Symptoms    string    `sheet:"Symptoms,optional"`
+	What        Medicine  `sheet:"Medicine,optional"` // The medicine it was logged with, if any.
+}
+
+const (
+	minTemperature = 30.0
+	maxTemperature = 45.0
+)
+
+// Validate catches the observations that don't say anything, or a temperature that isn't in °C.
+func (o Observation) Validate() error {
+	if o.Temperature == 0 && o.Symptoms == "" {
+		return errors.New("an observation needs a temperature or some symptoms")
+	}
+	if o.Temperature != 0 && (o.Temperature < minTemperature || o.Temperature > maxTemperature) {
+		return fmt.Errorf("a temperature of %v°C isn't plausible, it must be between %v and %v", o.Temperature, minTemperature, maxTemperature)
+	}
+	return nil
+}
+
+// ObservationsOf returns the observations of someone between two times, oldest first.
+func (s *Snapshot) ObservationsOf(who Person, from, to time.Time) []Observation {
+	observations := make([]Observation, 0)
+	for _, observation := range s.Observations {
+		if observation.Who == who && !observation.When.Before(from) && !observation.When.After(to) {
+			observations = append(observations, observation)
+		}
+	}
+	slices.SortStableFunc(observations, func(a, b Observation) int { return a.When.Compare(b.When) })
+	return observations
+}
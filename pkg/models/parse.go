@@ -9,22 +9,29 @@ import (
 	"time"
 )
 
+// Unmarshall reads a row into v, the times without an offset are in UTC.
 func Unmarshall(row, header []interface{}, v any) error {
+	return UnmarshallIn(row, header, v, time.UTC)
+}
+
+// UnmarshallIn reads a row into v, the times without an offset are in loc as typed by a human.
+// Every time is returned in loc, except the dates without a time of day which stay at midnight UTC.
+func UnmarshallIn(row, header []interface{}, v any, loc *time.Location) error {
+	return UnmarshallSince(row, header, v, loc, time.Time{})
+}
+
+// UnmarshallSince is UnmarshallIn for the rows the app wrote in UTC without an offset before it kept them:
+// the times without an offset before since are in UTC and the later ones in loc.
+func UnmarshallSince(row, header []interface{}, v any, loc *time.Location, since time.Time) error {
 	val := reflect.ValueOf(v).Elem()
 	typ := val.Type()
 
 	for i := 0; i < typ.NumField(); i++ {
 		field := typ.Field(i)
-		tag := field.Tag.Get("sheet")
-		if tag == "" {
+		columnName, format, optional := sheetTag(field)
+		if columnName == "" {
 			continue
 		}
-		parts := strings.SplitN(tag, ",", 2)
-		columnName := parts[0]
-		format := ""
-		if len(parts) > 1 {
-			format = parts[1]
-		}
 
 		var colIndex int
 		found := false
@@ -37,6 +44,9 @@ func Unmarshall(row, header []interface{}, v any) error {
 		}
 
 		if !found {
+			if optional {
+				continue
+			}
 			return fmt.Errorf("header %s not found", columnName)
 		}
 
@@ -45,13 +55,22 @@ func Unmarshall(row, header []interface{}, v any) error {
 		}
 		cellValue := row[colIndex]
 		fieldValue := val.Field(i)
+		if optional && cellValue.(string) == "" {
+			continue
+		}
 
 		switch fieldValue.Kind() {
 		case reflect.String:
 			fieldValue.SetString(cellValue.(string))
+		case reflect.Bool:
+			value, err := strconv.ParseBool(cellValue.(string))
+			if err != nil {
+				return fmt.Errorf("unable to parse bool for field %s: %v", field.Name, err)
+			}
+			fieldValue.SetBool(value)
 		case reflect.Int, reflect.Int64:
 			if fieldValue.Type() == reflect.TypeOf(time.Duration(0)) {
-				duration, err := parseDuration(cellValue.(string))
+				duration, err := ParseDuration(cellValue.(string))
 				if err != nil {
 					return fmt.Errorf("unable to parse duration for field %s: %v", field.Name, err)
 				}
@@ -63,13 +82,25 @@ func Unmarshall(row, header []interface{}, v any) error {
 				}
 				fieldValue.SetInt(value)
 			}
+		case reflect.Float64:
+			value, err := strconv.ParseFloat(cellValue.(string), 64)
+			if err != nil {
+				return fmt.Errorf("unable to parse float for field %s: %v", field.Name, err)
+			}
+			fieldValue.SetFloat(value)
 		case reflect.Struct:
 			switch fieldValue.Type() {
 			case reflect.TypeOf(time.Time{}):
 				if format == "" {
 					format = time.DateOnly
 				}
-				parsedTime, err := time.Parse(format, cellValue.(string))
+				var parsedTime time.Time
+				var err error
+				if hasTimeOfDay(format) {
+					parsedTime, err = parseTimeSince(cellValue.(string), format, loc, since)
+				} else {
+					parsedTime, err = ParseTime(cellValue.(string), format, time.UTC)
+				}
 				if err != nil {
 					return fmt.Errorf("unable to parse date: %v", err)
 				}
@@ -83,6 +114,126 @@ func Unmarshall(row, header []interface{}, v any) error {
 	return nil
 }
 
+// Marshall is the reverse of Unmarshall, it lays the fields of v out in the order of the header.
+// Columns that don't match any field are left empty, while a field that is set but has no column is an error
+// rather than being silently dropped.
+func Marshall(header []interface{}, v any) ([]interface{}, error) {
+	return MarshallIn(header, v, time.UTC)
+}
+
+// MarshallIn is the reverse of UnmarshallIn, the times of day are written in loc along with their offset.
+func MarshallIn(header []interface{}, v any, loc *time.Location) ([]interface{}, error) {
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Pointer {
+		val = val.Elem()
+	}
+	typ := val.Type()
+
+	row := make([]interface{}, len(header))
+	for j := range row {
+		row[j] = ""
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		columnName, format, _ := sheetTag(field)
+		if columnName == "" {
+			continue
+		}
+		colIndex := -1
+		for j, h := range header {
+			if h.(string) == columnName {
+				colIndex = j
+				break
+			}
+		}
+		fieldValue := val.Field(i)
+		if colIndex < 0 {
+			if !fieldValue.IsZero() {
+				return nil, fmt.Errorf("no %q column to write %s in", columnName, field.Name)
+			}
+			continue // The sheet doesn't track this field and there is nothing to lose.
+		}
+		switch fieldValue.Kind() {
+		case reflect.String:
+			row[colIndex] = fieldValue.String()
+		case reflect.Bool:
+			row[colIndex] = fieldValue.Bool()
+		case reflect.Int, reflect.Int64:
+			if fieldValue.Type() == reflect.TypeOf(time.Duration(0)) {
+				row[colIndex] = time.Duration(fieldValue.Int()).String()
+			} else {
+				row[colIndex] = strconv.FormatInt(fieldValue.Int(), 10)
+			}
+		case reflect.Float64:
+			row[colIndex] = strconv.FormatFloat(fieldValue.Float(), 'f', -1, 64)
+		case reflect.Struct:
+			switch fieldValue.Type() {
+			case reflect.TypeOf(time.Time{}):
+				if format == "" {
+					format = time.DateOnly
+				}
+				if t := fieldValue.Interface().(time.Time); !t.IsZero() && hasTimeOfDay(format) {
+					row[colIndex] = t.In(loc).Format(format + offsetSuffix)
+				} else if !t.IsZero() {
+					row[colIndex] = t.Format(format)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported field type: %s", fieldValue.Kind())
+		}
+	}
+
+	return row, nil
+}
+
+// offsetSuffix is appended to the layout of the times of day, eg. 2024-01-02 03:04:05 +01:00.
+const offsetSuffix = " -07:00"
+
+func hasTimeOfDay(layout string) bool {
+	return strings.Contains(layout, "15")
+}
+
+// ParseTime parses a value in layout, with or without an offset. Without one it's in loc.
+// The result is in loc either way.
+func ParseTime(value, layout string, loc *time.Location) (time.Time, error) {
+	if t, ok := parseWithOffset(value, layout); ok {
+		return t.In(loc), nil
+	}
+	return time.ParseInLocation(layout, value, loc)
+}
+
+// parseTimeSince is ParseTime where the values without an offset before since are in UTC.
+func parseTimeSince(value, layout string, loc *time.Location, since time.Time) (time.Time, error) {
+	if t, ok := parseWithOffset(value, layout); ok {
+		return t.In(loc), nil
+	}
+	if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil && t.Before(since) {
+		return t.In(loc), nil
+	}
+	return time.ParseInLocation(layout, value, loc)
+}
+
+func parseWithOffset(value, layout string) (time.Time, bool) {
+	for _, withOffset := range []string{layout + " Z07:00", layout + "Z07:00", time.RFC3339} {
+		if t, err := time.Parse(withOffset, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// sheetTag splits a `sheet:"Column name,format,optional"` struct tag.
+// Optional columns may be missing from the sheet or left empty, the field then keeps its zero value.
+func sheetTag(field reflect.StructField) (columnName, format string, optional bool) {
+	tag := field.Tag.Get("sheet")
+	columnName, format, _ = strings.Cut(tag, ",")
+	if format == "optional" || strings.HasSuffix(format, ",optional") {
+		format = strings.TrimSuffix(strings.TrimSuffix(format, "optional"), ",")
+		optional = true
+	}
+	return columnName, format, optional
+}
+
 var unitMap = map[string]uint64{
 	"ns": uint64(time.Nanosecond),
 	"us": uint64(time.Microsecond),
@@ -97,8 +248,8 @@ var unitMap = map[string]uint64{
 	"y":  365 * 24 * uint64(time.Hour),
 }
 
-// Same as time.ParseDuration but with support for `d` days and `y` years.
-func parseDuration(s string) (time.Duration, error) {
+// ParseDuration is the same as time.ParseDuration but with support for `d` days and `y` years.
+func ParseDuration(s string) (time.Duration, error) {
 	// [-+]?([0-9]*(\.[0-9]*)?[a-z]+)+
 	orig := s
 	var d uint64
@@ -0,0 +1,125 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+func TestUnmarshall(t *testing.T) {
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		header  []interface{}
+		row     []interface{}
+		want    models.Dose
+		wantErr bool
+	}{
+		{
+			name:   "Optional columns missing",
+			header: []interface{}{"Person", "Medicine", "When"},
+			row:    []interface{}{"John", "Aspirin", "2024-01-02 03:04:05"},
+			want:   models.Dose{Who: "John", What: "Aspirin", When: when},
+		},
+		{
+			name:   "Optional columns empty",
+			header: []interface{}{"Person", "Medicine", "When", "Override", "Override reason"},
+			row:    []interface{}{"John", "Aspirin", "2024-01-02 03:04:05", "", ""},
+			want:   models.Dose{Who: "John", What: "Aspirin", When: when},
+		},
+		{
+			name:   "Optional columns populated",
+			header: []interface{}{"Override reason", "Override", "Person", "Medicine", "When"},
+			row:    []interface{}{"doctor said so", "TRUE", "John", "Aspirin", "2024-01-02 03:04:05"},
+			want:   models.Dose{Who: "John", What: "Aspirin", When: when, Override: true, OverrideReason: "doctor said so"},
+		},
+		{
+			name:    "Required column missing",
+			header:  []interface{}{"Person", "Medicine"},
+			row:     []interface{}{"John", "Aspirin"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got models.Dose
+			err := models.Unmarshall(tt.row, tt.header, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshall() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); !tt.wantErr && diff != "" {
+				t.Errorf("Unmarshall() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMarshall(t *testing.T) {
+	header := []interface{}{"When", "Comment", "Person", "Medicine", "Override"}
+	dose := models.Dose{Who: "John", What: "Aspirin", When: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Override: true}
+	got, err := models.Marshall(header, dose)
+	if err != nil {
+		t.Fatalf("Marshall() error = %v", err)
+	}
+	want := []interface{}{"2024-01-02 03:04:05 +00:00", "", "John", "Aspirin", true}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Marshall() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMarshallMissingColumn(t *testing.T) {
+	header := []interface{}{"Person", "Medicine", "When"}
+	dose := models.Dose{Who: "John", What: "Aspirin", When: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if _, err := models.Marshall(header, dose); err != nil {
+		t.Errorf("Marshall() of unset optional fields error = %v, want nil", err)
+	}
+	dose.Override = true
+	if _, err := models.Marshall(header, dose); err == nil {
+		t.Errorf("Marshall() with an Override but no column for it succeeded, want an error")
+	}
+}
+
+func TestTimeZones(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	header := []interface{}{"Person", "Medicine", "When"}
+	when := time.Date(2024, 1, 2, 2, 4, 5, 0, time.UTC) // 03:04:05 in Paris.
+	for _, value := range []string{"2024-01-02 03:04:05", "2024-01-02 03:04:05 +01:00", "2024-01-02 02:04:05 Z", "2024-01-02T02:04:05Z"} {
+		var got models.Dose
+		if err := models.UnmarshallIn([]interface{}{"John", "Aspirin", value}, header, &got, paris); err != nil {
+			t.Fatalf("UnmarshallIn(%q) error = %v", value, err)
+		}
+		if !got.When.Equal(when) || got.When.Location() != paris {
+			t.Errorf("UnmarshallIn(%q) = %v, want %v in Paris", value, got.When, when)
+		}
+	}
+
+	since := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Time{
+		"2024-01-01 03:04:05":        time.Date(2024, 1, 1, 3, 4, 5, 0, time.UTC), // Before since, in UTC.
+		"2024-01-01 03:04:05 +01:00": time.Date(2024, 1, 1, 2, 4, 5, 0, time.UTC),
+		"2024-01-02 03:04:05":        when,
+	} {
+		var got models.Dose
+		if err := models.UnmarshallSince([]interface{}{"John", "Aspirin", value}, header, &got, paris, since); err != nil {
+			t.Fatalf("UnmarshallSince(%q) error = %v", value, err)
+		}
+		if !got.When.Equal(want) {
+			t.Errorf("UnmarshallSince(%q) = %v, want %v", value, got.When, want)
+		}
+	}
+
+	got, err := models.MarshallIn(header, models.Dose{Who: "John", What: "Aspirin", When: when}, paris)
+	if err != nil {
+		t.Fatalf("MarshallIn() error = %v", err)
+	}
+	if want := []interface{}{"John", "Aspirin", "2024-01-02 03:04:05 +01:00"}; !cmp.Equal(want, got) {
+		t.Errorf("MarshallIn() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Prescription is a course of treatment, eg. an antibiotic 3 times a day for 7 days.
+// Unlike the posology of a medicine given as needed, every scheduled dose is expected.
+type Prescription struct {
+	Who         Person    `sheet:"Person"`
+	What        Medicine  `sheet:"Medicine"`
+	Dose        string    `sheet:"Dose"`
+	TimesPerDay int64     `sheet:"Times per day"`
+	Start       time.Time `sheet:"Start"`
+	End         time.Time `sheet:"End"`            // The last day of the treatment, included.
+	Times       string    `sheet:"Times,optional"` // eg. "08:00 14:00 20:00", spread between 8am and 8pm when empty.
+}
+
+const (
+	firstDoseOfTheDay = 8 * time.Hour
+	lastDoseOfTheDay  = 20 * time.Hour
+)
+
+// timesOfDay returns when each dose is due, as an offset from midnight.
+func (p Prescription) timesOfDay() ([]time.Duration, error) {
+	if p.Times == "" {
+		if p.TimesPerDay <= 0 {
+			return nil, fmt.Errorf("%d times per day isn't a schedule", p.TimesPerDay)
+		}
+		if p.TimesPerDay == 1 {
+			return []time.Duration{firstDoseOfTheDay}, nil
+		}
+		offsets := make([]time.Duration, 0, p.TimesPerDay)
+		step := (lastDoseOfTheDay - firstDoseOfTheDay) / time.Duration(p.TimesPerDay-1)
+		for i := range p.TimesPerDay {
+			offsets = append(offsets, firstDoseOfTheDay+time.Duration(i)*step)
+		}
+		return offsets, nil
+	}
+
+	offsets := make([]time.Duration, 0)
+	for _, field := range strings.Fields(strings.ReplaceAll(p.Times, ",", " ")) {
+		at, err := time.Parse("15:04", field)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse time of day %q: %v", field, err)
+		}
+		offsets = append(offsets, time.Duration(at.Hour())*time.Hour+time.Duration(at.Minute())*time.Minute)
+	}
+	if int64(len(offsets)) != p.TimesPerDay {
+		return nil, fmt.Errorf("%d times of day for %d times per day", len(offsets), p.TimesPerDay)
+	}
+	return offsets, nil
+}
+
+// Validate catches the prescriptions that wouldn't make a schedule.
+func (p Prescription) Validate() error {
+	if p.End.Before(p.Start) {
+		return fmt.Errorf("it ends on %s before it starts on %s", p.End.Format(time.DateOnly), p.Start.Format(time.DateOnly))
+	}
+	_, err := p.timesOfDay()
+	return err
+}
+
+// tolerance is how far from its scheduled time a dose still counts for it.
+func (p Prescription) tolerance() time.Duration {
+	return 12 * time.Hour / time.Duration(max(p.TimesPerDay, 1))
+}
+
+type ScheduleStatus string
+
+const (
+	ScheduleTaken    ScheduleStatus = "taken"
+	ScheduleMissed   ScheduleStatus = "missed"
+	ScheduleDue      ScheduleStatus = "due"
+	ScheduleUpcoming ScheduleStatus = "upcoming"
+)
+
+// ScheduledDose is a dose a prescription expects, along with the dose from the events that fulfilled it if any.
+type ScheduledDose struct {
+	At     time.Time
+	Status ScheduleStatus
+	Taken  *Dose
+}
+
+// Progress sums up how a prescription is going.
+type Progress struct {
+	Prescription Prescription
+	Schedule     []ScheduledDose
+	Taken        int
+	Missed       int
+	Total        int
+}
+
+// Percent is how much of the treatment was taken.
+func (p Progress) Percent() int {
+	if p.Total == 0 {
+		return 0
+	}
+	return 100 * p.Taken / p.Total
+}
+
+// Progress matches the scheduled doses with the doses that were logged, as of a given time.
+// The times of day are in the location of loc, and so are the times of the doses taken.
+func (s *Snapshot) Progress(prescription Prescription, now time.Time, loc *time.Location) (Progress, error) {
+	offsets, err := prescription.timesOfDay()
+	if err != nil {
+		return Progress{}, err
+	}
+	progress := Progress{Prescription: prescription}
+
+	doses := make([]Dose, 0)
+	for _, dose := range s.Events {
+		if dose.Who == prescription.Who && dose.What == prescription.What {
+			dose.When = dose.When.In(loc)
+			doses = append(doses, dose)
+		}
+	}
+	used := make([]bool, len(doses))
+
+	tolerance := prescription.tolerance()
+	start := time.Date(prescription.Start.Year(), prescription.Start.Month(), prescription.Start.Day(), 0, 0, 0, 0, loc)
+	end := time.Date(prescription.End.Year(), prescription.End.Month(), prescription.End.Day(), 0, 0, 0, 0, loc)
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		for _, offset := range offsets {
+			scheduled := ScheduledDose{At: day.Add(offset)}
+			// The closest dose that isn't already counted for another scheduled dose.
+			best := -1
+			for i, dose := range doses {
+				distance := dose.When.Sub(scheduled.At).Abs()
+				if used[i] || distance > tolerance {
+					continue
+				}
+				if best < 0 || distance < doses[best].When.Sub(scheduled.At).Abs() {
+					best = i
+				}
+			}
+			switch {
+			case best >= 0:
+				used[best] = true
+				scheduled.Status = ScheduleTaken
+				scheduled.Taken = &doses[best]
+				progress.Taken++
+			case now.After(scheduled.At.Add(tolerance)):
+				scheduled.Status = ScheduleMissed
+				progress.Missed++
+			case now.After(scheduled.At.Add(-tolerance)):
+				scheduled.Status = ScheduleDue
+			default:
+				scheduled.Status = ScheduleUpcoming
+			}
+			progress.Schedule = append(progress.Schedule, scheduled)
+		}
+	}
+	progress.Total = len(progress.Schedule)
+	return progress, nil
+}
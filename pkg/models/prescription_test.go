@@ -0,0 +1,70 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+func TestProgress(t *testing.T) {
+	day := func(d, hour, minute int) time.Time { return time.Date(2024, 1, d, hour, minute, 0, 0, time.UTC) }
+	prescription := models.Prescription{Who: "John", What: "Amoxicillin", Dose: "5 mL", TimesPerDay: 3, Start: day(1, 0, 0), End: day(2, 0, 0)}
+	snapshot := models.Snapshot{}
+	for _, dose := range []models.Dose{
+		{Who: "John", What: "Amoxicillin", When: day(1, 8, 30)},
+		{Who: "John", What: "Amoxicillin", When: day(1, 20, 10)}, // 14:00 was missed.
+		{Who: "John", What: "Doliprane", When: day(2, 8, 0)},     // Another medicine doesn't count.
+		{Who: "Jane", What: "Amoxicillin", When: day(2, 8, 0)},   // Neither does someone else.
+		{Who: "John", What: "Amoxicillin", When: day(2, 11, 0)},  // Late but within the tolerance.
+	} {
+		snapshot.AddDose(dose)
+	}
+
+	got, err := snapshot.Progress(prescription, day(2, 15, 0), time.UTC)
+	if err != nil {
+		t.Fatalf("Progress() error = %v", err)
+	}
+	want := []models.ScheduledDose{
+		{At: day(1, 8, 0), Status: models.ScheduleTaken},
+		{At: day(1, 14, 0), Status: models.ScheduleMissed},
+		{At: day(1, 20, 0), Status: models.ScheduleTaken},
+		{At: day(2, 8, 0), Status: models.ScheduleTaken},
+		{At: day(2, 14, 0), Status: models.ScheduleDue},
+		{At: day(2, 20, 0), Status: models.ScheduleUpcoming},
+	}
+	if diff := cmp.Diff(want, got.Schedule, cmp.Transformer("", func(d models.ScheduledDose) models.ScheduledDose {
+		d.Taken = nil
+		return d
+	})); diff != "" {
+		t.Errorf("Progress() schedule mismatch (-want +got):\n%s", diff)
+	}
+	if got.Taken != 3 || got.Missed != 1 || got.Total != 6 || got.Percent() != 50 {
+		t.Errorf("Progress() = %d taken, %d missed of %d (%d%%), want 3 taken, 1 missed of 6 (50%%)", got.Taken, got.Missed, got.Total, got.Percent())
+	}
+}
+
+func TestPrescriptionValidate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		prescription models.Prescription
+		wantErr      bool
+	}{
+		{name: "Spread over the day", prescription: models.Prescription{TimesPerDay: 3, Start: start, End: start}},
+		{name: "Explicit times", prescription: models.Prescription{TimesPerDay: 2, Start: start, End: start, Times: "09:00, 21:00"}},
+		{name: "Not enough times", prescription: models.Prescription{TimesPerDay: 3, Start: start, End: start, Times: "09:00 21:00"}, wantErr: true},
+		{name: "Invalid time", prescription: models.Prescription{TimesPerDay: 1, Start: start, End: start, Times: "9am"}, wantErr: true},
+		{name: "No doses", prescription: models.Prescription{Start: start, End: start}, wantErr: true},
+		{name: "Ends before it starts", prescription: models.Prescription{TimesPerDay: 1, Start: start, End: start.AddDate(0, 0, -1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.prescription.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// StockItem is a box or a bottle of a medicine. Its quantity is counted when it's added,
+// the doses logged since then are taken from it so that undoing a dose puts it back.
+type StockItem struct {
+	What      Medicine      `sheet:"Medicine"`
+	Quantity  float64       `sheet:"Quantity"`
+	Unit      string        `sheet:"Unit,optional"` // mL or mg, anything else counts the doses, eg. pill.
+	Added     time.Time     `sheet:"Added"`
+	Expiry    time.Time     `sheet:"Expiry"`
+	Opened    time.Time     `sheet:"Opened,optional"`     // Defaults to the first dose taken from it.
+	ShelfLife time.Duration `sheet:"Shelf life,optional"` // How long it keeps once opened, eg. 4w for a syrup.
+	LowAt     float64       `sheet:"Low at,optional"`     // Time to buy more below that quantity, only when empty otherwise.
+}
+
+// Validate catches the mistakes that would make the stock wrong.
+func (i StockItem) Validate() error {
+	if i.Quantity < 0 || i.LowAt < 0 {
+		return errors.New("the quantity can't be negative")
+	}
+	if i.ShelfLife < 0 {
+		return errors.New("the shelf life can't be negative")
+	}
+	if i.Expiry.Before(i.Added) {
+		return fmt.Errorf("it expired on %s before it was added on %s", i.Expiry.Format(time.DateOnly), i.Added.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// StockLevel is what is left of a stock item.
+type StockLevel struct {
+	Item      StockItem
+	Remaining float64
+	Opened    time.Time // Zero while it's still sealed.
+	Expires   time.Time // The earliest of the expiry date and the end of the shelf life once opened.
+	Expired   bool
+	Low       bool
+}
+
+func (l *StockLevel) expires() time.Time {
+	if l.Opened.IsZero() || l.Item.ShelfLife == 0 {
+		return l.Item.Expiry
+	}
+	return minTime(l.Item.Expiry, l.Opened.Add(l.Item.ShelfLife))
+}
+
+func (l *StockLevel) usable(at time.Time) bool {
+	return !l.Item.Added.After(at) && l.Remaining > 0 && at.Before(l.expires())
+}
+
+// StockStatus sums up the stock of a medicine.
+type StockStatus struct {
+	Levels  []StockLevel // Empty items are left out.
+	Tracked bool         // There is any stock item for that medicine.
+	Low     bool         // Nothing usable is left above its threshold.
+	Expired bool         // Something that isn't empty has expired, it should be thrown away.
+	// Some doses couldn't be taken off, eg. a syrup counted in mL when the posology has no concentration,
+	// so there may be less left than the levels tell.
+	Uncounted bool
+}
+
+// Empty tells whether nothing usable is left, ie. everything is either used up or expired.
+func (s StockStatus) Empty() bool {
+	for _, level := range s.Levels {
+		if !level.Expired {
+			return false
+		}
+	}
+	return true
+}
+
+// Stock replays the doses of a medicine logged up to now against its stock items.
+// Each dose is taken from the opened items first, then from the ones that expire first.
+func (s *Snapshot) Stock(what Medicine, now time.Time) StockStatus {
+	levels := make([]StockLevel, 0)
+	for _, item := range s.StockItems(what) {
+		levels = append(levels, StockLevel{Item: item, Remaining: item.Quantity, Opened: item.Opened})
+	}
+	status := StockStatus{Tracked: len(levels) > 0}
+	if !status.Tracked {
+		return status
+	}
+
+	doses := make([]Dose, 0)
+	for _, dose := range s.Events {
+		if dose.What == what && !dose.When.After(now) {
+			doses = append(doses, dose)
+		}
+	}
+	slices.SortStableFunc(doses, func(a, b Dose) int { return a.When.Compare(b.When) })
+	for _, dose := range doses {
+		// The zero posology still counts the doses of a product counted in pills when none applies.
+		posology, _ := s.GetPosologyAt(dose.Who, dose.What, dose.When)
+		weight, _ := s.Weight(dose.Who, dose.When)
+		slices.SortStableFunc(levels, func(a, b StockLevel) int {
+			if a.Opened.IsZero() != b.Opened.IsZero() {
+				if a.Opened.IsZero() {
+					return 1
+				}
+				return -1
+			}
+			return a.expires().Compare(b.expires())
+		})
+		for i := range levels {
+			level := &levels[i]
+			if !level.usable(dose.When) {
+				continue
+			}
+			amount, ok := posology.Consumes(weight, level.Item.Unit)
+			if !ok {
+				status.Uncounted = true
+				break
+			}
+			if level.Opened.IsZero() {
+				level.Opened = dose.When
+			}
+			level.Remaining = max(level.Remaining-amount, 0)
+			break
+		}
+	}
+
+	status.Low = true
+	for _, level := range levels {
+		if level.Remaining <= 0 {
+			continue
+		}
+		level.Expires = level.expires()
+		level.Expired = !now.Before(level.Expires)
+		level.Low = level.Remaining <= level.Item.LowAt
+		if level.Expired {
+			status.Expired = true
+		} else if !level.Low {
+			status.Low = false
+		}
+		status.Levels = append(status.Levels, level)
+	}
+	slices.SortStableFunc(status.Levels, func(a, b StockLevel) int {
+		return cmp.Or(a.Expires.Compare(b.Expires), a.Item.Added.Compare(b.Item.Added))
+	})
+	return status
+}
+
+// StockItems returns the stock items of a medicine.
+func (s *Snapshot) StockItems(what Medicine) []StockItem {
+	items := make([]StockItem, 0)
+	for _, item := range s.Inventory {
+		if item.What == what {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
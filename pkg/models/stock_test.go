@@ -0,0 +1,137 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+func TestStock(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	snapshot := models.Snapshot{
+		People: models.PeopleSlice{{Name: "John", Birth: day(1).AddDate(-10, 0, 0), Weight: 20}},
+		Medicines: models.MedicinesMap{
+			"Doliprane": &models.MedicineCfg{Posology: []models.PosologyEntry{
+				{Dose: "15 mg/kg", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour, PerKg: 15, Concentration: 24},
+			}},
+			"Aspirin": &models.MedicineCfg{Posology: []models.PosologyEntry{
+				{Dose: "1 pill", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour},
+			}},
+			"Syrup": &models.MedicineCfg{Posology: []models.PosologyEntry{
+				{Dose: "5 mL", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour},
+			}},
+		},
+	}
+	for _, dose := range []models.Dose{
+		{Who: "John", What: "Doliprane", When: day(2).Add(8 * time.Hour)},
+		{Who: "John", What: "Doliprane", When: day(2).Add(20 * time.Hour)},
+		{Who: "John", What: "Aspirin", When: day(3)},
+		{Who: "John", What: "Aspirin", When: day(4)},
+		{Who: "John", What: "Syrup", When: day(4)},
+	} {
+		snapshot.AddDose(dose)
+	}
+
+	tests := []struct {
+		name          string
+		inventory     []models.StockItem
+		what          models.Medicine
+		now           time.Time
+		wantRemaining []float64
+		wantLow       bool
+		wantExpired   bool
+		wantEmpty     bool
+		wantUncounted bool
+	}{
+		{
+			name:      "Untracked",
+			what:      "Aspirin",
+			now:       day(5),
+			wantEmpty: true,
+		},
+		{
+			name:          "Volume of weight based doses",
+			inventory:     []models.StockItem{{What: "Doliprane", Quantity: 100, Unit: "mL", Added: day(1), Expiry: day(31)}},
+			what:          "Doliprane",
+			now:           day(5),
+			wantRemaining: []float64{75}, // 12.5 mL twice.
+		},
+		{
+			name:          "Counted doses",
+			inventory:     []models.StockItem{{What: "Aspirin", Quantity: 4, Unit: "pill", Added: day(1), Expiry: day(31), LowAt: 2}},
+			what:          "Aspirin",
+			now:           day(5),
+			wantRemaining: []float64{2},
+			wantLow:       true,
+		},
+		{
+			name:      "Used up",
+			inventory: []models.StockItem{{What: "Aspirin", Quantity: 2, Unit: "pill", Added: day(1), Expiry: day(31)}},
+			what:      "Aspirin",
+			now:       day(5),
+			wantLow:   true,
+			wantEmpty: true,
+		},
+		{
+			name: "Opened first",
+			inventory: []models.StockItem{
+				{What: "Aspirin", Quantity: 10, Added: day(1), Expiry: day(20)},
+				{What: "Aspirin", Quantity: 10, Added: day(1), Expiry: day(31), Opened: day(1)},
+			},
+			what:          "Aspirin",
+			now:           day(5),
+			wantRemaining: []float64{10, 8},
+		},
+		{
+			name:          "Shelf life once opened",
+			inventory:     []models.StockItem{{What: "Doliprane", Quantity: 100, Unit: "mL", Added: day(1), Expiry: day(31), ShelfLife: 7 * 24 * time.Hour}},
+			what:          "Doliprane",
+			now:           day(10), // Opened by the first dose on the 2nd.
+			wantRemaining: []float64{75},
+			wantLow:       true,
+			wantExpired:   true,
+			wantEmpty:     true,
+		},
+		{
+			// The posology doesn't tell how many mL "5 mL" is.
+			name:          "Volume without a concentration",
+			inventory:     []models.StockItem{{What: "Syrup", Quantity: 100, Unit: "mL", Added: day(1), Expiry: day(31)}},
+			what:          "Syrup",
+			now:           day(5),
+			wantRemaining: []float64{100},
+			wantUncounted: true,
+		},
+		{
+			name:          "Added after the doses",
+			inventory:     []models.StockItem{{What: "Aspirin", Quantity: 10, Added: day(5), Expiry: day(31)}},
+			what:          "Aspirin",
+			now:           day(5),
+			wantRemaining: []float64{10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot.Inventory = tt.inventory
+			got := snapshot.Stock(tt.what, tt.now)
+			remaining := make([]float64, 0)
+			for _, level := range got.Levels {
+				remaining = append(remaining, level.Remaining)
+			}
+			if len(remaining) != len(tt.wantRemaining) {
+				t.Fatalf("Stock() remaining = %v, want %v", remaining, tt.wantRemaining)
+			}
+			for i := range remaining {
+				if remaining[i] != tt.wantRemaining[i] {
+					t.Errorf("Stock() remaining = %v, want %v", remaining, tt.wantRemaining)
+				}
+			}
+			if got.Low != tt.wantLow || got.Expired != tt.wantExpired || got.Empty() != tt.wantEmpty {
+				t.Errorf("Stock() low = %v, expired = %v, empty = %v, want %v, %v and %v", got.Low, got.Expired, got.Empty(), tt.wantLow, tt.wantExpired, tt.wantEmpty)
+			}
+			if got.Uncounted != tt.wantUncounted {
+				t.Errorf("Stock() uncounted = %v, want %v", got.Uncounted, tt.wantUncounted)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+// Package mqtt publishes dose events and whether each person can take each medicine to an MQTT broker,
+// eg. for Home Assistant to display and automate around them.
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/nanassito/medicine/pkg/models"
+	"github.com/nanassito/medicine/pkg/store"
+)
+
+const publishTimeout = 10 * time.Second
+
+type Publisher interface {
+	Publish(topic string, retained bool, payload []byte) error
+}
+
+type pahoPublisher struct {
+	client paho.Client
+}
+
+// Connect returns a publisher for the broker, eg. tcp://localhost:1883.
+// It keeps trying to (re)connect in the background so the app works while the broker is down.
+func Connect(broker, clientID string) (Publisher, error) {
+	opts := paho.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetAutoReconnect(true).
+		SetConnectRetry(true)
+	client := paho.NewClient(opts)
+	token := client.Connect()
+	if token.WaitTimeout(publishTimeout) && token.Error() != nil {
+		return nil, fmt.Errorf("unable to connect to %s: %v", broker, token.Error())
+	}
+	return &pahoPublisher{client: client}, nil
+}
+
+func (p *pahoPublisher) Publish(topic string, retained bool, payload []byte) error {
+	token := p.client.Publish(topic, 1, retained, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	return token.Error()
+}
+
+// DoseEvent is published to <prefix>/<person>/<medicine>/dose every time a dose is logged.
+type DoseEvent struct {
+	ID             string    `json:"id"`
+	Person         string    `json:"person"`
+	Medicine       string    `json:"medicine"`
+	When           time.Time `json:"when"`
+	Override       bool      `json:"override,omitempty"`
+	OverrideReason string    `json:"override_reason,omitempty"`
+	GivenBy        string    `json:"given_by,omitempty"`
+}
+
+// State is retained on <prefix>/<person>/<medicine>/state and republished when it changes.
+type State struct {
+	CanTake   bool       `json:"can_take"`
+	Reason    string     `json:"reason"`
+	Dose      string     `json:"dose,omitempty"`
+	WaitUntil *time.Time `json:"wait_until,omitempty"`
+}
+
+// queueSize is how many doses may wait to be published while the broker is slow or down.
+const queueSize = 100
+
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// Store publishes the doses logged through it and keeps the retained states up to date.
+// Nothing is published from the requests, a slow broker would hold them, Run does it in the background.
+type Store struct {
+	store.Store
+	Publisher Publisher
+	Prefix    string
+
+	doses   chan message
+	changed chan struct{} // The states need to be republished.
+
+	mu   sync.Mutex
+	last map[string]State // Latest state published on each topic.
+}
+
+func NewStore(st store.Store, publisher Publisher, prefix string) *Store {
+	return &Store{
+		Store:     st,
+		Publisher: publisher,
+		Prefix:    prefix,
+		doses:     make(chan message, queueSize),
+		changed:   make(chan struct{}, 1),
+		last:      make(map[string]State),
+	}
+}
+
+// Run publishes the doses and republishes the states after a change and as time goes by,
+// eg. once enough time passed since the last dose.
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.PublishStates(ctx); err != nil {
+			slog.Error("unable to publish the states", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case dose := <-s.doses:
+			if err := s.Publisher.Publish(dose.topic, false, dose.payload); err != nil {
+				slog.Error("unable to publish the dose", "error", err, "topic", dose.topic)
+			}
+		case <-s.changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// notify wakes Run up to republish the states.
+func (s *Store) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default: // Already pending.
+	}
+}
+
+func (s *Store) LogDose(ctx context.Context, dose models.Dose) error {
+	if err := s.Store.LogDose(ctx, dose); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(DoseEvent{
+		ID:             dose.Key(),
+		Person:         string(dose.Who),
+		Medicine:       string(dose.What),
+		When:           dose.When,
+		Override:       dose.Override,
+		OverrideReason: dose.OverrideReason,
+		GivenBy:        dose.GivenBy,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to encode the dose: %v", err)
+	}
+	// The dose is recorded already, failing to publish it must not make the caller retry.
+	// Run republishes the states after publishing it.
+	select {
+	case s.doses <- message{topic: s.topic(dose.Who, dose.What, "dose"), payload: payload}:
+	default:
+		slog.Error("too many doses waiting to be published, dropping it", "dose", dose.Key())
+		s.notify()
+	}
+	return nil
+}
+
+func (s *Store) DeleteDose(ctx context.Context, key string, by string) error {
+	if err := s.Store.DeleteDose(ctx, key, by); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// LogWeight republishes the states as a new weight may change which posology applies.
+func (s *Store) LogWeight(ctx context.Context, measurement models.WeightMeasurement) error {
+	if err := s.Store.LogWeight(ctx, measurement); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// PublishStates publishes the state of every person and medicine pair that changed since it was last published.
+func (s *Store) PublishStates(ctx context.Context) error {
+	snapshot, err := s.Snapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve data: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, person := range snapshot.People {
+		for medicine := range snapshot.Medicines {
+			canTake, reason, posology, waitFor := snapshot.CanTakeAt(person.Name, medicine, now)
+			state := State{CanTake: canTake, Reason: reason, Dose: posology.Dose}
+			if waitFor > 0 {
+				// Derived from the last doses so it doesn't drift from one run to the next.
+				waitUntil := now.Add(waitFor).Truncate(time.Second)
+				state.WaitUntil = &waitUntil
+			}
+
+			topic := s.topic(person.Name, medicine, "state")
+			if last, ok := s.last[topic]; ok && sameState(last, state) {
+				continue
+			}
+			payload, err := json.Marshal(state)
+			if err != nil {
+				return fmt.Errorf("unable to encode the state: %v", err)
+			}
+			if err := s.Publisher.Publish(topic, true, payload); err != nil {
+				return fmt.Errorf("unable to publish to %s: %v", topic, err)
+			}
+			s.last[topic] = state
+		}
+	}
+	return nil
+}
+
+func sameState(a, b State) bool {
+	if (a.WaitUntil == nil) != (b.WaitUntil == nil) {
+		return false
+	}
+	if a.WaitUntil != nil && !a.WaitUntil.Equal(*b.WaitUntil) {
+		return false
+	}
+	return a.CanTake == b.CanTake && a.Reason == b.Reason && a.Dose == b.Dose
+}
+
+// topicEscaper drops the characters that have a special meaning in topics.
+var topicEscaper = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// TopicLevel makes a name safe to use as a single level of a topic, eg. the name of a household.
+func TopicLevel(name string) string {
+	return topicEscaper.Replace(name)
+}
+
+// Topic is the one of a person and medicine pair, <prefix>/<person>/<medicine>/<kind>, eg. kind is dose or state.
+func Topic(prefix string, who models.Person, what models.Medicine, kind string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", prefix, TopicLevel(string(who)), TopicLevel(string(what)), kind)
+}
+
+func (s *Store) topic(who models.Person, what models.Medicine, kind string) string {
+	return Topic(s.Prefix, who, what, kind)
+}
@@ -0,0 +1,165 @@
+package mqtt_test
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanassito/medicine/pkg/models"
+	"github.com/nanassito/medicine/pkg/mqtt"
+)
+
+type message struct {
+	topic    string
+	retained bool
+	payload  []byte
+}
+
+type fakePublisher struct {
+	mu       sync.Mutex
+	messages []message
+	blocked  chan struct{} // Publish waits for it to be closed when set, like a broker that is down.
+}
+
+func (f *fakePublisher) Publish(topic string, retained bool, payload []byte) error {
+	if f.blocked != nil {
+		<-f.blocked
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, message{topic: topic, retained: retained, payload: payload})
+	return nil
+}
+
+// wait returns the messages once there are n of them, Run publishes them in the background.
+func (f *fakePublisher) wait(t *testing.T, n int) []message {
+	t.Helper()
+	var messages []message
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		f.mu.Lock()
+		messages = slices.Clone(f.messages)
+		f.mu.Unlock()
+		if len(messages) >= n {
+			return messages
+		}
+	}
+	t.Fatalf("published %v, want %d messages", messages, n)
+	return nil
+}
+
+type fakeStore struct {
+	mu       sync.Mutex
+	snapshot models.Snapshot
+}
+
+func (f *fakeStore) Snapshot(ctx context.Context) (models.Snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.snapshot, nil
+}
+
+func (f *fakeStore) LogDose(ctx context.Context, dose models.Dose) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Start over as Snapshot shares the events and doses with the callers.
+	events := append(slices.Clone(f.snapshot.Events), dose)
+	f.snapshot.Events, f.snapshot.Doses = nil, nil
+	for _, event := range events {
+		f.snapshot.AddDose(event)
+	}
+	return nil
+}
+
+func (f *fakeStore) DeleteDose(ctx context.Context, key string, by string) error {
+	return nil
+}
+
+func (f *fakeStore) LogWeight(ctx context.Context, measurement models.WeightMeasurement) error {
+	return nil
+}
+
+func (f *fakeStore) LogObservation(ctx context.Context, observation models.Observation) error {
+	return nil
+}
+
+func testSnapshot() models.Snapshot {
+	return models.Snapshot{
+		People: models.PeopleSlice{{Name: "John", Birth: time.Now().AddDate(-10, 0, 0)}},
+		Medicines: models.MedicinesMap{
+			"Aspirin": &models.MedicineCfg{Posology: []models.PosologyEntry{
+				{Dose: "1 pill", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour},
+			}},
+		},
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	publisher := &fakePublisher{}
+	st := mqtt.NewStore(&fakeStore{snapshot: testSnapshot()}, publisher, "medicine")
+	go st.Run(ctx, time.Hour)
+
+	publisher.wait(t, 1)
+	if err := st.PublishStates(ctx); err != nil {
+		t.Fatalf("PublishStates() error = %v", err)
+	}
+	messages := publisher.wait(t, 1)
+	if len(messages) != 1 {
+		t.Fatalf("published %d messages, want a single state since nothing changed: %v", len(messages), messages)
+	}
+	if got := messages[0]; got.topic != "medicine/John/Aspirin/state" || !got.retained {
+		t.Errorf("published %s (retained: %v), want the retained state of John and Aspirin", got.topic, got.retained)
+	}
+
+	when := time.Now()
+	if err := st.LogDose(ctx, models.Dose{ID: "abc", Who: "John", What: "Aspirin", When: when}); err != nil {
+		t.Fatalf("LogDose() error = %v", err)
+	}
+	messages = publisher.wait(t, 3)
+	if len(messages) != 3 {
+		t.Fatalf("published %d messages, want the dose and the new state: %v", len(messages), messages)
+	}
+	var dose mqtt.DoseEvent
+	if got := messages[1]; got.topic != "medicine/John/Aspirin/dose" || got.retained || json.Unmarshal(got.payload, &dose) != nil || dose.ID != "abc" {
+		t.Errorf("published %s %s (retained: %v), want the dose abc", got.topic, got.payload, got.retained)
+	}
+	var state mqtt.State
+	if err := json.Unmarshal(messages[2].payload, &state); err != nil {
+		t.Fatalf("unable to decode the state: %v", err)
+	}
+	if wantUntil := when.Add(6 * time.Hour).Truncate(time.Second); state.CanTake || state.WaitUntil == nil || !state.WaitUntil.Equal(wantUntil) {
+		t.Errorf("state = %+v, want to wait until %v", state, wantUntil)
+	}
+}
+
+func TestStoreBrokerDown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	publisher := &fakePublisher{blocked: make(chan struct{})}
+	fake := &fakeStore{snapshot: testSnapshot()}
+	st := mqtt.NewStore(fake, publisher, "medicine")
+	go st.Run(ctx, time.Hour)
+
+	done := make(chan error)
+	go func() {
+		done <- st.LogDose(ctx, models.Dose{ID: "abc", Who: "John", What: "Aspirin", When: time.Now()})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("LogDose() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("LogDose() waits for the broker")
+	}
+
+	close(publisher.blocked)
+	messages := publisher.wait(t, 2)
+	if !slices.ContainsFunc(messages, func(m message) bool { return m.topic == "medicine/John/Aspirin/dose" }) {
+		t.Errorf("published %v, want the dose once the broker is back", messages)
+	}
+}
@@ -0,0 +1,70 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/nanassito/medicine/pkg/mqtt"
+)
+
+// Notifier tells the caregivers that a dose is allowed again.
+type Notifier interface {
+	Notify(ctx context.Context, reminder Reminder) error
+}
+
+// Log only logs the reminders, handy to try the scheduler locally.
+type Log struct{}
+
+func (Log) Notify(ctx context.Context, reminder Reminder) error {
+	slog.Info("reminder", "person", reminder.Person, "medicine", reminder.Medicine, "dose", reminder.Dose, "since", reminder.At)
+	return nil
+}
+
+// Webhook POSTs the reminder as JSON to URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (wh Webhook) Notify(ctx context.Context, reminder Reminder) error {
+	body, err := json.Marshal(reminder)
+	if err != nil {
+		return fmt.Errorf("unable to encode the reminder: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create the request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := wh.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to call the webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("the webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// MQTT publishes the reminder to <prefix>/<person>/<medicine>/reminder.
+type MQTT struct {
+	Publisher mqtt.Publisher
+	Prefix    string
+}
+
+func (m MQTT) Notify(ctx context.Context, reminder Reminder) error {
+	payload, err := json.Marshal(reminder)
+	if err != nil {
+		return fmt.Errorf("unable to encode the reminder: %v", err)
+	}
+	return m.Publisher.Publish(mqtt.Topic(m.Prefix, reminder.Person, reminder.Medicine, "reminder"), false, payload)
+}
@@ -0,0 +1,122 @@
+// Package reminders notifies the caregivers when someone is allowed to take their next dose.
+package reminders
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nanassito/medicine/pkg/models"
+	"github.com/nanassito/medicine/pkg/store"
+)
+
+// Pair is a person and medicine someone wants to be reminded about.
+type Pair struct {
+	Person   models.Person   `json:"person"`
+	Medicine models.Medicine `json:"medicine"`
+}
+
+type Config struct {
+	Pairs   []Pair `json:"pairs"`
+	Webhook string `json:"webhook"` // Optional URL to POST the reminders to.
+}
+
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return cfg, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Reminder is sent once the wait after the last doses is over.
+type Reminder struct {
+	Person   models.Person   `json:"person"`
+	Medicine models.Medicine `json:"medicine"`
+	Dose     string          `json:"dose"`
+	At       time.Time       `json:"at"` // When the dose became allowed.
+}
+
+type Scheduler struct {
+	Store     store.Store
+	Pairs     []Pair
+	Notifiers []Notifier
+	Interval  time.Duration // Longest time between two checks, eg. to notice newly logged doses.
+
+	mu      sync.Mutex
+	pending map[Pair]time.Time // When each pair that must wait will be allowed again.
+}
+
+func NewScheduler(st store.Store, pairs []Pair, interval time.Duration, notifiers ...Notifier) *Scheduler {
+	return &Scheduler{Store: st, Pairs: pairs, Notifiers: notifiers, Interval: interval, pending: make(map[Pair]time.Time)}
+}
+
+// Run checks the pairs until the context is cancelled, waking up right when the next one is due.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		next, err := s.Check(ctx, time.Now())
+		if err != nil {
+			slog.Error("unable to check the reminders", "error", err)
+		}
+		wait := s.Interval
+		if !next.IsZero() {
+			wait = min(wait, time.Until(next))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Check notifies about the pairs whose wait is over and returns when the next one is due, zero if none is.
+func (s *Scheduler) Check(ctx context.Context, now time.Time) (next time.Time, err error) {
+	snapshot, err := s.Store.Snapshot(ctx)
+	if err != nil {
+		return next, fmt.Errorf("unable to retrieve data: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, pair := range s.Pairs {
+		canTake, _, posology, waitFor := snapshot.CanTakeAt(pair.Person, pair.Medicine, now)
+		due, wasWaiting := s.pending[pair]
+		switch {
+		case !canTake && waitFor > 0:
+			due = now.Add(waitFor)
+			s.pending[pair] = due
+			if next.IsZero() || due.Before(next) {
+				next = due
+			}
+		case canTake && wasWaiting:
+			delete(s.pending, pair)
+			// The wait can also end early when the last dose is deleted, nobody needs a reminder then.
+			if now.Before(due) {
+				continue
+			}
+			s.notify(ctx, Reminder{Person: pair.Person, Medicine: pair.Medicine, Dose: posology.Dose, At: due})
+		default:
+			delete(s.pending, pair)
+		}
+	}
+	return next, nil
+}
+
+func (s *Scheduler) notify(ctx context.Context, reminder Reminder) {
+	for _, notifier := range s.Notifiers {
+		if err := notifier.Notify(ctx, reminder); err != nil {
+			slog.Error("unable to send a reminder", "person", reminder.Person, "medicine", reminder.Medicine, "error", err)
+		}
+	}
+}
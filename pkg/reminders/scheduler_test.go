@@ -0,0 +1,146 @@
+package reminders_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/nanassito/medicine/pkg/models"
+	"github.com/nanassito/medicine/pkg/reminders"
+)
+
+type fakeStore struct {
+	snapshot models.Snapshot
+}
+
+func (f *fakeStore) Snapshot(ctx context.Context) (models.Snapshot, error) {
+	return f.snapshot, nil
+}
+
+func (f *fakeStore) LogDose(ctx context.Context, dose models.Dose) error {
+	f.snapshot.AddDose(dose)
+	return nil
+}
+
+func (f *fakeStore) DeleteDose(ctx context.Context, key string, by string) error {
+	return nil
+}
+
+func (f *fakeStore) LogWeight(ctx context.Context, measurement models.WeightMeasurement) error {
+	return nil
+}
+
+func (f *fakeStore) LogObservation(ctx context.Context, observation models.Observation) error {
+	return nil
+}
+
+type fakeNotifier struct {
+	reminders []reminders.Reminder
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, reminder reminders.Reminder) error {
+	f.reminders = append(f.reminders, reminder)
+	return nil
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	st := &fakeStore{snapshot: models.Snapshot{
+		People: models.PeopleSlice{{Name: "John", Birth: time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)}},
+		Medicines: models.MedicinesMap{
+			"Aspirin": &models.MedicineCfg{Posology: []models.PosologyEntry{
+				{Dose: "1 pill", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour},
+			}},
+			"Doliprane": &models.MedicineCfg{Posology: []models.PosologyEntry{
+				{Dose: "1 pill", DoseInterval: 4 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour},
+			}},
+		},
+	}}
+	notifier := &fakeNotifier{}
+	scheduler := reminders.NewScheduler(st, []reminders.Pair{{Person: "John", Medicine: "Aspirin"}}, time.Minute, notifier)
+
+	steps := []struct {
+		name     string
+		dose     models.Medicine // Logged right before checking.
+		at       time.Time
+		wantNext time.Time
+		want     []reminders.Reminder
+	}{
+		{name: "Never had a dose", at: start},
+		{name: "Right after a dose", dose: "Aspirin", at: start, wantNext: start.Add(6 * time.Hour)},
+		{name: "Other medicines are ignored", dose: "Doliprane", at: start.Add(time.Hour), wantNext: start.Add(6 * time.Hour)},
+		{name: "Still waiting", at: start.Add(5 * time.Hour), wantNext: start.Add(6 * time.Hour)},
+		{name: "Wait is over", at: start.Add(6 * time.Hour), want: []reminders.Reminder{
+			{Person: "John", Medicine: "Aspirin", Dose: "1 pill", At: start.Add(6 * time.Hour)},
+		}},
+		{name: "Notified once", at: start.Add(7 * time.Hour), want: []reminders.Reminder{
+			{Person: "John", Medicine: "Aspirin", Dose: "1 pill", At: start.Add(6 * time.Hour)},
+		}},
+	}
+	for _, step := range steps {
+		if step.dose != "" {
+			if err := st.LogDose(ctx, models.Dose{Who: "John", What: step.dose, When: step.at}); err != nil {
+				t.Fatalf("%s: LogDose() error = %v", step.name, err)
+			}
+		}
+		next, err := scheduler.Check(ctx, step.at)
+		if err != nil {
+			t.Fatalf("%s: Check() error = %v", step.name, err)
+		}
+		if !next.Equal(step.wantNext) {
+			t.Errorf("%s: Check() next = %v, want %v", step.name, next, step.wantNext)
+		}
+		if diff := cmp.Diff(step.want, notifier.reminders); diff != "" {
+			t.Errorf("%s: reminders mismatch (-want +got):\n%s", step.name, diff)
+		}
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var got reminders.Reminder
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	want := reminders.Reminder{Person: "John", Medicine: "Aspirin", Dose: "1 pill", At: time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)}
+	if err := (reminders.Webhook{URL: server.URL}).Notify(context.Background(), want); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("webhook received mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := (reminders.Webhook{URL: server.URL + "/missing\x7f"}).Notify(context.Background(), want); err == nil {
+		t.Errorf("Notify() to an invalid URL error = nil, want an error")
+	}
+}
+
+type fakePublisher struct {
+	topics []string
+}
+
+func (f *fakePublisher) Publish(topic string, retained bool, payload []byte) error {
+	f.topics = append(f.topics, topic)
+	return nil
+}
+
+func TestMQTT(t *testing.T) {
+	publisher := &fakePublisher{}
+	reminder := reminders.Reminder{Person: "John/Doe", Medicine: "Aspirin", Dose: "1 pill"}
+	if err := (reminders.MQTT{Publisher: publisher, Prefix: "medicine"}).Notify(context.Background(), reminder); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	// Same scheme as the doses and states, see mqtt.Topic.
+	if want := []string{"medicine/John_Doe/Aspirin/reminder"}; !cmp.Equal(want, publisher.topics) {
+		t.Errorf("published to %v, want %v", publisher.topics, want)
+	}
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nanassito/medicine/pkg/models"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cached keeps the last snapshot of another Store in memory so that pages don't have to wait on it.
+// The snapshot is refreshed in the background by Run and dropped as soon as something is written.
+type Cached struct {
+	Store
+	Interval time.Duration
+
+	mu         sync.Mutex
+	snapshot   models.Snapshot
+	valid      bool
+	generation int // Bumped on every invalidation so that an in-flight refresh doesn't resurrect stale data.
+	refreshes  singleflight.Group
+}
+
+var _ Store = (*Cached)(nil)
+
+func NewCached(st Store, interval time.Duration) *Cached {
+	return &Cached{Store: st, Interval: interval}
+}
+
+// Run refreshes the snapshot every Interval until the context is cancelled.
+func (c *Cached) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.refresh(ctx); err != nil {
+				slog.Error("unable to refresh snapshot", "error", err)
+			}
+		}
+	}
+}
+
+// refresh reads the underlying Store, sharing the read with every other caller waiting on the same generation
+// so that a burst of page loads after a write only costs a single read.
+func (c *Cached) refresh(ctx context.Context) (models.Snapshot, error) {
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+
+	// The shared read must not fail just because the caller that started it went away.
+	flight := c.refreshes.DoChan(strconv.Itoa(generation), func() (interface{}, error) {
+		snapshot, err := c.Store.Snapshot(context.WithoutCancel(ctx))
+		if err != nil {
+			return snapshot, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if generation == c.generation {
+			c.snapshot = snapshot
+			c.valid = true
+		}
+		return snapshot, nil
+	})
+	select {
+	case <-ctx.Done():
+		return models.Snapshot{}, ctx.Err()
+	case result := <-flight:
+		return result.Val.(models.Snapshot), result.Err
+	}
+}
+
+// Invalidate forces the next call to Snapshot to go to the underlying Store.
+func (c *Cached) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.valid = false
+	c.generation++
+}
+
+func (c *Cached) Snapshot(ctx context.Context) (models.Snapshot, error) {
+	c.mu.Lock()
+	snapshot, valid := c.snapshot, c.valid
+	c.mu.Unlock()
+	if valid {
+		return snapshot, nil
+	}
+	return c.refresh(ctx)
+}
+
+func (c *Cached) LogDose(ctx context.Context, dose models.Dose) error {
+	defer c.Invalidate()
+	return c.Store.LogDose(ctx, dose)
+}
+
+func (c *Cached) DeleteDose(ctx context.Context, key string, by string) error {
+	defer c.Invalidate()
+	return c.Store.DeleteDose(ctx, key, by)
+}
+
+func (c *Cached) LogWeight(ctx context.Context, measurement models.WeightMeasurement) error {
+	defer c.Invalidate()
+	return c.Store.LogWeight(ctx, measurement)
+}
+
+func (c *Cached) LogObservation(ctx context.Context, observation models.Observation) error {
+	defer c.Invalidate()
+	return c.Store.LogObservation(ctx, observation)
+}
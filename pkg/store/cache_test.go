@@ -0,0 +1,122 @@
+package store_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanassito/medicine/pkg/models"
+	"github.com/nanassito/medicine/pkg/store"
+)
+
+type countingStore struct {
+	mu        sync.Mutex
+	snapshots int
+	started   chan struct{} // Signaled when a read starts, if set.
+	release   chan struct{} // Blocks reads until closed, if set.
+}
+
+func (c *countingStore) Snapshot(ctx context.Context) (models.Snapshot, error) {
+	c.mu.Lock()
+	c.snapshots++
+	c.mu.Unlock()
+	if c.started != nil {
+		c.started <- struct{}{}
+	}
+	if c.release != nil {
+		<-c.release
+	}
+	return models.Snapshot{FetchedAt: time.Now()}, nil
+}
+
+func (c *countingStore) LogDose(ctx context.Context, dose models.Dose) error {
+	return nil
+}
+
+func (c *countingStore) DeleteDose(ctx context.Context, key string, by string) error {
+	return nil
+}
+
+func (c *countingStore) LogWeight(ctx context.Context, measurement models.WeightMeasurement) error {
+	return nil
+}
+
+func (c *countingStore) LogObservation(ctx context.Context, observation models.Observation) error {
+	return nil
+}
+
+func TestCached(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStore{}
+	cached := store.NewCached(inner, time.Hour)
+
+	for range 3 {
+		if _, err := cached.Snapshot(ctx); err != nil {
+			t.Fatalf("Snapshot() error = %v", err)
+		}
+	}
+	if inner.snapshots != 1 {
+		t.Errorf("underlying store was read %d times, want 1", inner.snapshots)
+	}
+
+	if err := cached.LogDose(ctx, models.Dose{Who: "John", What: "Aspirin", When: time.Now()}); err != nil {
+		t.Fatalf("LogDose() error = %v", err)
+	}
+	if _, err := cached.Snapshot(ctx); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if inner.snapshots != 2 {
+		t.Errorf("underlying store was read %d times after logging a dose, want 2", inner.snapshots)
+	}
+}
+
+func TestCachedCoalescesRefreshes(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStore{started: make(chan struct{}, 10), release: make(chan struct{})}
+	cached := store.NewCached(inner, time.Hour)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			if _, err := cached.Snapshot(ctx); err != nil {
+				t.Errorf("Snapshot() error = %v", err)
+			}
+		})
+	}
+	<-inner.started
+	// Give the other callers a chance to pile up behind the read in flight.
+	time.Sleep(50 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	if inner.snapshots != 1 {
+		t.Errorf("underlying store was read %d times by concurrent callers, want 1", inner.snapshots)
+	}
+}
+
+func TestCachedCancelledCaller(t *testing.T) {
+	inner := &countingStore{started: make(chan struct{}, 10), release: make(chan struct{})}
+	cached := store.NewCached(inner, time.Hour)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := cached.Snapshot(cancelled)
+		done <- err
+	}()
+	<-inner.started
+	waiting := make(chan error)
+	go func() {
+		_, err := cached.Snapshot(context.Background())
+		waiting <- err
+	}()
+	cancel()
+	if err := <-done; err == nil {
+		t.Errorf("Snapshot() with a cancelled context succeeded, want an error")
+	}
+	close(inner.release)
+	if err := <-waiting; err != nil {
+		t.Errorf("Snapshot() error = %v after another caller gave up, want nil", err)
+	}
+}
@@ -0,0 +1,479 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+// SheetsConfig tells where the data lives. Ranges use the A1 notation, a bare tab name
+// reads every column and relies on the header row to find the fields.
+type SheetsConfig struct {
+	DocID     string `json:"doc_id"`
+	People    string `json:"people"`
+	Medicines string `json:"medicines"` // The medicine of each posology entry is in its Name or Medicine column.
+	Events    string `json:"events"`
+	Audit     string `json:"audit"`
+	// The tabs below are optional, a spreadsheet without one of them has no rows in it.
+	Weights string `json:"weights"`
+	// Interactions and contraindications forbid some doses whatever the posology says.
+	Interactions      string `json:"interactions"`
+	Contraindications string `json:"contraindications"`
+	Prescriptions     string `json:"prescriptions"`
+	Stock             string `json:"stock"`
+	Observations      string `json:"observations"`
+	// TimeZone is the one of the household, eg. Europe/Paris. The times typed without an offset are in it
+	// and the times are written in it. UTC when empty, which is how the times were read before.
+	TimeZone string `json:"time_zone"`
+	// TimeZoneSince is when the app started to write the offsets, eg. 2026-10-18T00:00:00Z. It wrote the times
+	// before it in UTC without one, so those are still read in UTC. Required along with TimeZone.
+	TimeZoneSince string `json:"time_zone_since"`
+}
+
+var DefaultSheetsConfig = SheetsConfig{
+	DocID:     "1MGRP9e0aUBvukLeo2oAP1WP4NM7mBkGn1Z0wyakOdbo",
+	People:    "People",
+	Medicines: "Medicines",
+	Events:    "Events",
+	Audit:     "Audit",
+	Weights:   "Weights",
+
+	Interactions:      "Interactions",
+	Contraindications: "Contraindications",
+	Prescriptions:     "Prescriptions",
+	Stock:             "Stock",
+	Observations:      "Observations",
+}
+
+// LoadSheetsConfig reads a JSON config file, missing fields keep their default value.
+func LoadSheetsConfig(path string) (SheetsConfig, error) {
+	cfg := DefaultSheetsConfig
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("unable to read sheets config: %v", err)
+	}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return cfg, fmt.Errorf("unable to parse sheets config: %v", err)
+	}
+	return cfg, nil
+}
+
+// Sheets keeps the data in a Google Sheet with one tab for each of People, Medicines and Events.
+type Sheets struct {
+	GSheetSvc *sheets.Service
+	Config    SheetsConfig
+	// Location is the time zone of the household from Config.TimeZone, UTC when there is none.
+	Location *time.Location
+
+	since time.Time // See SheetsConfig.TimeZoneSince.
+}
+
+var _ Store = (*Sheets)(nil)
+
+func NewSheets(svc *sheets.Service, cfg SheetsConfig) (*Sheets, error) {
+	location, since := time.UTC, time.Time{}
+	if cfg.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(cfg.TimeZone); err != nil {
+			return nil, fmt.Errorf("unable to load time zone: %v", err)
+		}
+		if cfg.TimeZoneSince == "" {
+			return nil, errors.New("time_zone_since is required along with time_zone, set it to when the app was upgraded so that the times it wrote in UTC before stay so")
+		}
+		if since, err = time.Parse(time.RFC3339, cfg.TimeZoneSince); err != nil {
+			return nil, fmt.Errorf("unable to parse time_zone_since: %v", err)
+		}
+	}
+	_, err := svc.Spreadsheets.Get(cfg.DocID).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve document: %v", err)
+	}
+	return &Sheets{GSheetSvc: svc, Config: cfg, Location: location, since: since}, nil
+}
+
+// unmarshall reads a row in the time zone of the household.
+func (s *Sheets) unmarshall(row, header []interface{}, v any) error {
+	return models.UnmarshallSince(row, header, v, s.Location, s.since)
+}
+
+// getRows reads a range and splits it between the header and the data rows.
+func (s *Sheets) getRows(ctx context.Context, rng string) (header []interface{}, rows [][]interface{}, err error) {
+	val, err := s.GSheetSvc.Spreadsheets.Values.Get(s.Config.DocID, rng).Context(ctx).Do()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(val.Values) == 0 {
+		return nil, nil, fmt.Errorf("range %s has %w", rng, errNoHeader)
+	}
+	return val.Values[0], val.Values[1:], nil
+}
+
+var errNoHeader = errors.New("no header")
+
+// getOptionalRows is getRows for the tabs added after the first version, a spreadsheet that doesn't have
+// one yet, or whose config doesn't name it, simply has no rows in it.
+func (s *Sheets) getOptionalRows(ctx context.Context, rng string) (header []interface{}, rows [][]interface{}, err error) {
+	if rng == "" {
+		return nil, nil, nil
+	}
+	header, rows, err = s.getRows(ctx, rng)
+	if errors.Is(err, errNoHeader) || isMissingRange(err) {
+		return nil, nil, nil
+	}
+	return header, rows, err
+}
+
+// isMissingRange tells whether the API refused a range because its tab doesn't exist.
+func isMissingRange(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest && strings.Contains(strings.ToLower(apiErr.Error()), "unable to parse range")
+}
+
+// headerRange narrows a range down to its first row, eg. `Events!A:C` becomes `Events!A1:C1`
+// and `Events` becomes `Events!1:1`.
+func headerRange(rng string) string {
+	tab, cells, ok := strings.Cut(rng, "!")
+	if !ok {
+		return tab + "!1:1"
+	}
+	fromCell, toCell, _ := strings.Cut(cells, ":")
+	fromCol := strings.TrimRight(fromCell, "0123456789")
+	toCol := strings.TrimRight(toCell, "0123456789")
+	row := strings.TrimPrefix(fromCell, fromCol)
+	if row == "" {
+		row = "1"
+	}
+	return fmt.Sprintf("%s!%s%s:%s%s", tab, fromCol, row, toCol, row)
+}
+
+// cellRange addresses a single cell of a range, col and row are offsets from its top left cell,
+// eg. the cell at col 2 and row 1 of `Events!B3:F` is `Events!D4`.
+func cellRange(rng string, col, row int) string {
+	tab, cells, _ := strings.Cut(rng, "!")
+	fromCell, _, _ := strings.Cut(cells, ":")
+	fromCol := strings.TrimRight(fromCell, "0123456789")
+	fromRow, err := strconv.Atoi(strings.TrimPrefix(fromCell, fromCol))
+	if err != nil {
+		fromRow = 1
+	}
+	colIndex := 0
+	for _, c := range fromCol {
+		colIndex = colIndex*26 + int(c-'A'+1)
+	}
+	colIndex = max(colIndex-1, 0) + col
+	letters := ""
+	for n := colIndex + 1; n > 0; n = (n - 1) / 26 {
+		letters = string(rune('A'+(n-1)%26)) + letters
+	}
+	return fmt.Sprintf("%s!%s%d", tab, letters, fromRow+row)
+}
+
+// appendRow adds v at the end of a range, following the order of its header.
+func (s *Sheets) appendRow(ctx context.Context, rng string, v any) error {
+	header, _, err := s.getRows(ctx, headerRange(rng))
+	if err != nil {
+		return fmt.Errorf("unable to retrieve the header of %s: %v", rng, err)
+	}
+	row, err := models.MarshallIn(header, v, s.Location)
+	if err != nil {
+		return fmt.Errorf("unable to format row: %v", err)
+	}
+	_, err = s.GSheetSvc.Spreadsheets.Values.Append(s.Config.DocID, rng, &sheets.ValueRange{
+		Values: [][]interface{}{row},
+	}).InsertDataOption("INSERT_ROWS").ValueInputOption("USER_ENTERED").Context(ctx).Do()
+	return err
+}
+
+func (s *Sheets) getPeople(ctx context.Context) (models.PeopleSlice, error) {
+	header, rows, err := s.getRows(ctx, s.Config.People)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve people from document: %v", err)
+	}
+
+	people := make(models.PeopleSlice, 0)
+	for _, row := range rows {
+		var personCfg models.PersonCfg
+		err := s.unmarshall(row, header, &personCfg)
+		if err != nil {
+			return nil, err
+		}
+		people = append(people, personCfg)
+	}
+
+	return people, nil
+}
+
+// getTab reads the rows of an optional tab, eg. the interactions. See getOptionalRows.
+func getTab[T any](ctx context.Context, s *Sheets, rng string) ([]T, error) {
+	header, rows, err := s.getOptionalRows(ctx, rng)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve %s from document: %v", rng, err)
+	}
+
+	values := make([]T, 0, len(rows))
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		var value T
+		if err := s.unmarshall(row, header, &value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (s *Sheets) getEvents(ctx context.Context) ([]models.Dose, error) {
+	header, rows, err := s.getRows(ctx, s.Config.Events)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve doses from document: %v", err)
+	}
+
+	events := make([]models.Dose, 0, len(rows))
+	for _, row := range rows {
+		var dose models.Dose
+		if err := s.unmarshall(row, header, &dose); err != nil {
+			return nil, err
+		}
+		events = append(events, dose)
+	}
+	return events, nil
+}
+
+func (s *Sheets) getMedicines(ctx context.Context) (models.MedicinesMap, error) {
+	header, rows, err := s.getRows(ctx, s.Config.Medicines)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve medicines from document: %v", err)
+	}
+
+	nameCol := slices.IndexFunc(header, func(h interface{}) bool { return h == "Name" || h == "Medicine" })
+	if nameCol < 0 {
+		return nil, fmt.Errorf("add a Name column to %s for the name of the medicines", s.Config.Medicines)
+	}
+
+	medicines := make(models.MedicinesMap)
+	for _, row := range rows {
+		if nameCol >= len(row) {
+			continue
+		}
+		cell, _ := row[nameCol].(string)
+		name := models.Medicine(cell)
+		if name == "" {
+			continue
+		}
+		if _, ok := medicines[name]; !ok {
+			medicines[name] = &models.MedicineCfg{Posology: make([]models.PosologyEntry, 0)}
+		}
+		var posologyEntry models.PosologyEntry
+		err := s.unmarshall(row, header, &posologyEntry)
+		if err != nil {
+			return nil, err
+		}
+		if err := posologyEntry.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid posology for %s: %v", name, err)
+		}
+		medicine := medicines[name]
+		medicine.Posology = append(medicine.Posology, posologyEntry)
+	}
+
+	return medicines, nil
+}
+
+func (s *Sheets) Snapshot(ctx context.Context) (snapshot models.Snapshot, err error) {
+	snapshot.FetchedAt = time.Now()
+	group, ctx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		people, err := s.getPeople(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve people: %v", err)
+		}
+		snapshot.People = people
+		return nil
+	})
+	group.Go(func() error {
+		medicines, err := s.getMedicines(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve medicines: %v", err)
+		}
+		snapshot.Medicines = medicines
+		return nil
+	})
+	var events []models.Dose
+	group.Go(func() error {
+		doses, err := s.getEvents(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve doses: %v", err)
+		}
+		events = doses
+		return nil
+	})
+	var weights []models.WeightMeasurement
+	group.Go(func() error {
+		measurements, err := getTab[models.WeightMeasurement](ctx, s, s.Config.Weights)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve weights: %v", err)
+		}
+		weights = measurements
+		return nil
+	})
+	group.Go(func() error {
+		interactions, err := getTab[models.Interaction](ctx, s, s.Config.Interactions)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve interactions: %v", err)
+		}
+		snapshot.Interactions = interactions
+		return nil
+	})
+	group.Go(func() error {
+		contraindications, err := getTab[models.Contraindication](ctx, s, s.Config.Contraindications)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve contraindications: %v", err)
+		}
+		snapshot.Contraindications = contraindications
+		return nil
+	})
+	group.Go(func() error {
+		prescriptions, err := getTab[models.Prescription](ctx, s, s.Config.Prescriptions)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve prescriptions: %v", err)
+		}
+		for _, prescription := range prescriptions {
+			if err := prescription.Validate(); err != nil {
+				return fmt.Errorf("invalid prescription of %s for %s: %v", prescription.What, prescription.Who, err)
+			}
+		}
+		snapshot.Prescriptions = prescriptions
+		return nil
+	})
+	group.Go(func() error {
+		inventory, err := getTab[models.StockItem](ctx, s, s.Config.Stock)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve stock: %v", err)
+		}
+		for _, item := range inventory {
+			if err := item.Validate(); err != nil {
+				return fmt.Errorf("invalid stock of %s added on %s: %v", item.What, item.Added.Format(time.DateOnly), err)
+			}
+		}
+		snapshot.Inventory = inventory
+		return nil
+	})
+	group.Go(func() error {
+		observations, err := getTab[models.Observation](ctx, s, s.Config.Observations)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve observations: %v", err)
+		}
+		snapshot.Observations = observations
+		return nil
+	})
+	if err := group.Wait(); err != nil {
+		return snapshot, err
+	}
+	snapshot.Doses = make(models.DosesMap)
+	for _, dose := range events {
+		snapshot.AddDose(dose)
+	}
+	for _, measurement := range weights {
+		if err := snapshot.AddWeight(measurement); err != nil {
+			return snapshot, err
+		}
+	}
+
+	return snapshot, nil
+}
+
+func (s *Sheets) LogDose(ctx context.Context, dose models.Dose) error {
+	slog.Info("dose intake", "person", dose.Who, "medicine", dose.What)
+	if err := s.appendRow(ctx, s.Config.Events, dose); err != nil {
+		slog.Error("unable to log dose intake", "error", err)
+		return fmt.Errorf("unable to log dose intake: %v", err)
+	}
+	return nil
+}
+
+func (s *Sheets) LogWeight(ctx context.Context, measurement models.WeightMeasurement) error {
+	slog.Info("weight measurement", "person", measurement.Who, "weight", measurement.Value, "unit", measurement.Unit)
+	if err := s.appendRow(ctx, s.Config.Weights, measurement); err != nil {
+		return fmt.Errorf("unable to log weight: %v", err)
+	}
+	return nil
+}
+
+func (s *Sheets) LogObservation(ctx context.Context, observation models.Observation) error {
+	slog.Info("observation", "person", observation.Who, "temperature", observation.Temperature)
+	if err := s.appendRow(ctx, s.Config.Observations, observation); err != nil {
+		return fmt.Errorf("unable to log observation: %v", err)
+	}
+	return nil
+}
+
+func (s *Sheets) DeleteDose(ctx context.Context, key string, by string) error {
+	slog.Info("deleting dose", "key", key, "by", by)
+	header, rows, err := s.getRows(ctx, s.Config.Events)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve doses from document: %v", err)
+	}
+	rowIndex := -1
+	var dose models.Dose
+	for i, row := range rows {
+		var candidate models.Dose
+		if err := s.unmarshall(row, header, &candidate); err != nil {
+			return err
+		}
+		if !candidate.Deleted() && candidate.Key() == key {
+			rowIndex, dose = i, candidate
+			break
+		}
+	}
+	if rowIndex < 0 {
+		return ErrDoseNotFound
+	}
+
+	dose.DeletedAt = time.Now()
+	dose.DeletedBy = by
+	tombstone, err := models.MarshallIn(header, dose, s.Location)
+	if err != nil {
+		return fmt.Errorf("unable to format tombstone: %v", err)
+	}
+	data := make([]*sheets.ValueRange, 0, 2)
+	for col, h := range header {
+		if h == "Deleted at" || h == "Deleted by" {
+			data = append(data, &sheets.ValueRange{
+				Range:  cellRange(s.Config.Events, col, rowIndex+1),
+				Values: [][]interface{}{{tombstone[col]}},
+			})
+		}
+	}
+	if len(data) != 2 {
+		return fmt.Errorf("add a `Deleted at` and a `Deleted by` column to %s to be able to delete doses", s.Config.Events)
+	}
+	_, err = s.GSheetSvc.Spreadsheets.Values.BatchUpdate(s.Config.DocID, &sheets.BatchUpdateValuesRequest{
+		Data:             data,
+		ValueInputOption: "USER_ENTERED",
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to delete dose: %v", err)
+	}
+
+	entry := models.AuditEntry{When: dose.DeletedAt, Who: by, Action: "delete dose", Details: dose.Key()}
+	if err := s.appendRow(ctx, s.Config.Audit, entry); err != nil {
+		slog.Error("unable to audit dose deletion", "error", err, "entry", entry)
+		return fmt.Errorf("dose deleted but unable to record it in the audit log: %v", err)
+	}
+	return nil
+}
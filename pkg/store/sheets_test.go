@@ -0,0 +1,238 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/nanassito/medicine/pkg/models"
+	"github.com/nanassito/medicine/pkg/store"
+	"github.com/nanassito/medicine/pkg/store/sheetstest"
+)
+
+func TestSheetsFollowsHeaders(t *testing.T) {
+	sheet := sheetstest.NewServer(t, "testdata/sheets")
+	cfg := store.DefaultSheetsConfig
+	cfg.People = "Household"
+	st, err := store.NewSheets(sheet.Service(t), cfg)
+	if err != nil {
+		t.Fatalf("NewSheets() error = %v", err)
+	}
+
+	logged := time.Date(2024, 1, 3, 4, 5, 6, 0, time.UTC)
+	if err := st.LogDose(context.Background(), models.Dose{Who: "John", What: "Aspirin", When: logged}); err != nil {
+		t.Fatalf("LogDose() error = %v", err)
+	}
+	wantEvents := [][]string{
+		{"When", "Person", "Medicine", "Comment"},
+		{"2024-01-02 03:04:05", "John", "Aspirin", ""},
+		{"2024-01-03 04:05:06 +00:00", "John", "Aspirin", ""},
+	}
+	if diff := cmp.Diff(wantEvents, sheet.Tab("Events")); diff != "" {
+		t.Errorf("Events mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err := st.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	want := models.Snapshot{
+		People: models.PeopleSlice{
+			{Name: "John", Birth: time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC), Weight: 30, PhotoUrl: "john.jpg"},
+		},
+		Medicines: models.MedicinesMap{
+			"Aspirin": &models.MedicineCfg{
+				Posology: []models.PosologyEntry{
+					{OlderThan: 2 * 365 * 24 * time.Hour, Dose: "1 pill", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour},
+				},
+			},
+		},
+		Doses: models.DosesMap{
+			"John": {"Aspirin": {time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), logged}},
+		},
+		Events: []models.Dose{
+			{Who: "John", What: "Aspirin", When: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			{Who: "John", What: "Aspirin", When: logged},
+		},
+		Weights: []models.WeightMeasurement{
+			{Who: "John", When: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Value: 30, Unit: "kg"},
+		},
+		Interactions: []models.Interaction{
+			{Medicine: "Ibuprofen", Other: "Aspirin", Within: 8 * time.Hour, Note: "reduces the effect of aspirin"},
+		},
+		Contraindications: []models.Contraindication{},
+		Prescriptions: []models.Prescription{
+			{Who: "John", What: "Aspirin", Dose: "1 pill", TimesPerDay: 3, Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		},
+		Inventory: []models.StockItem{
+			{What: "Aspirin", Quantity: 20, Unit: "pill", Added: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Expiry: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), LowAt: 4},
+		},
+		Observations: []models.Observation{},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(models.Snapshot{}, "FetchedAt")); diff != "" {
+		t.Errorf("Snapshot() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSheetsDeleteDose(t *testing.T) {
+	ctx := context.Background()
+	sheet := sheetstest.NewServer(t, "testdata/sheets")
+	cfg := store.DefaultSheetsConfig
+	cfg.People = "Household"
+	cfg.Events = "Tombstones!B:H"
+	st, err := store.NewSheets(sheet.Service(t), cfg)
+	if err != nil {
+		t.Fatalf("NewSheets() error = %v", err)
+	}
+
+	if err := st.DeleteDose(ctx, "abc", "Jane"); err != nil {
+		t.Fatalf("DeleteDose() error = %v", err)
+	}
+	if err := st.DeleteDose(ctx, "abc", "Jane"); err != store.ErrDoseNotFound {
+		t.Errorf("DeleteDose() twice error = %v, want %v", err, store.ErrDoseNotFound)
+	}
+
+	tombstones := sheet.Tab("Tombstones")
+	if got := tombstones[2]; len(got) != 8 || got[6] == "" || got[7] != "Jane" {
+		t.Errorf("deleted row = %q, want it tombstoned by Jane", got)
+	}
+	if got := tombstones[1]; len(got) > 6 && got[6] != "" {
+		t.Errorf("untouched row = %q, want it left alone", got)
+	}
+	audit := sheet.Tab("Audit")
+	if len(audit) != 2 || audit[1][1] != "Jane" || audit[1][3] != "abc" {
+		t.Errorf("Audit = %q, want a single entry for Jane deleting abc", audit)
+	}
+
+	snapshot, err := st.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if len(snapshot.Events) != 1 || snapshot.Events[0].ID != "" {
+		t.Errorf("Snapshot() events = %v, want only the dose without an ID", snapshot.Events)
+	}
+}
+
+func TestSheetsTimeZone(t *testing.T) {
+	ctx := context.Background()
+	if _, err := time.LoadLocation("Europe/Paris"); err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	sheet := sheetstest.NewServer(t, "testdata/sheets")
+	cfg := store.DefaultSheetsConfig
+	cfg.People = "Household"
+	cfg.Events = "Zoned"
+	cfg.TimeZone = "Europe/Paris"
+	if _, err := store.NewSheets(sheet.Service(t), cfg); err == nil {
+		t.Errorf("NewSheets() without time_zone_since error = nil, want one")
+	}
+	cfg.TimeZoneSince = "2024-01-03T00:00:00Z"
+	st, err := store.NewSheets(sheet.Service(t), cfg)
+	if err != nil {
+		t.Fatalf("NewSheets() error = %v", err)
+	}
+
+	if err := st.LogDose(ctx, models.Dose{ID: "def", Who: "John", What: "Aspirin", When: time.Date(2024, 1, 4, 4, 5, 6, 0, time.UTC)}); err != nil {
+		t.Fatalf("LogDose() error = %v", err)
+	}
+	if got := sheet.Tab("Zoned"); len(got) != 6 || got[5][3] != "2024-01-04 05:05:06 +01:00" {
+		t.Errorf("Zoned = %q, want the logged time in Paris with its offset", got)
+	}
+
+	snapshot, err := st.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	want := []time.Time{
+		time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC), // Logged by the app in UTC before the offsets.
+		time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC), // Same with an ID.
+		time.Date(2024, 1, 3, 8, 0, 0, 0, time.UTC), // Typed by hand in Paris since.
+		time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 4, 4, 5, 6, 0, time.UTC),
+	}
+	var got []time.Time
+	for _, dose := range snapshot.Events {
+		if zone := dose.When.Location().String(); zone != "Europe/Paris" {
+			t.Errorf("dose %s is in %s, want Europe/Paris", dose.Key(), zone)
+		}
+		got = append(got, dose.When)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Snapshot() times mismatch (-want +got):\n%s", diff)
+	}
+	if key := snapshot.Events[0].Key(); key != "John|Aspirin|2024-01-01 08:00:00" {
+		t.Errorf("Key() of the dose logged before the offsets = %q, want it unchanged", key)
+	}
+}
+
+func TestSheetsMissingTabs(t *testing.T) {
+	sheet := sheetstest.NewServer(t, "testdata/sheets")
+	for _, tab := range []string{"Missing", ""} {
+		cfg := store.DefaultSheetsConfig
+		cfg.People = "Household"
+		cfg.Weights = tab
+		cfg.Interactions = tab
+		cfg.Contraindications = tab
+		cfg.Prescriptions = tab
+		cfg.Stock = tab
+		cfg.Observations = tab
+		st, err := store.NewSheets(sheet.Service(t), cfg)
+		if err != nil {
+			t.Fatalf("NewSheets() error = %v", err)
+		}
+		snapshot, err := st.Snapshot(context.Background())
+		if err != nil {
+			t.Fatalf("Snapshot() with the optional tabs in %q error = %v", tab, err)
+		}
+		if len(snapshot.Weights)+len(snapshot.Interactions)+len(snapshot.Contraindications)+len(snapshot.Prescriptions)+len(snapshot.Inventory)+len(snapshot.Observations) != 0 {
+			t.Errorf("Snapshot() with the optional tabs in %q = %+v, want them empty", tab, snapshot)
+		}
+	}
+}
+
+func TestSheetsMissingColumns(t *testing.T) {
+	when := time.Date(2024, 1, 3, 4, 5, 6, 0, time.UTC)
+	tests := []struct {
+		name string
+		dose models.Dose
+	}{
+		{"Override", models.Dose{Who: "John", What: "Aspirin", When: when, Override: true}},
+		{"Override reason", models.Dose{Who: "John", What: "Aspirin", When: when, OverrideReason: "doctor said so"}},
+		// Without it the dose could neither be deduplicated nor found again to be undone.
+		{"ID", models.Dose{ID: "abc", Who: "John", What: "Aspirin", When: when}},
+		{"Given by", models.Dose{Who: "John", What: "Aspirin", When: when, GivenBy: "Jane"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheet := sheetstest.NewServer(t, "testdata/sheets")
+			cfg := store.DefaultSheetsConfig
+			cfg.People = "Household"
+			cfg.Events = "Legacy"
+			st, err := store.NewSheets(sheet.Service(t), cfg)
+			if err != nil {
+				t.Fatalf("NewSheets() error = %v", err)
+			}
+			if err := st.LogDose(context.Background(), tt.dose); err == nil {
+				t.Errorf("LogDose(%+v) without a %q column succeeded, want an error", tt.dose, tt.name)
+			}
+			if got := sheet.Tab("Legacy"); len(got) != 2 {
+				t.Errorf("Legacy = %q, want it left alone", got)
+			}
+		})
+	}
+
+	sheet := sheetstest.NewServer(t, "testdata/sheets")
+	cfg := store.DefaultSheetsConfig
+	cfg.People = "Household"
+	cfg.Events = "Legacy"
+	st, err := store.NewSheets(sheet.Service(t), cfg)
+	if err != nil {
+		t.Fatalf("NewSheets() error = %v", err)
+	}
+	if err := st.LogDose(context.Background(), models.Dose{Who: "John", What: "Aspirin", When: when}); err != nil {
+		t.Errorf("LogDose() of a plain dose error = %v, want it logged in the columns there are", err)
+	}
+}
@@ -0,0 +1,275 @@
+// Package sheetstest provides a local stand-in for the subset of the Google Sheets v4 API used by the app.
+package sheetstest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Server holds every tab of a single spreadsheet in memory, whatever the spreadsheet ID requested.
+type Server struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	tabs map[string][][]string
+}
+
+// NewServer starts a server seeded with every <tab name>.csv file found in dir.
+// The server is closed when the test ends.
+func NewServer(t testing.TB, dir string) *Server {
+	t.Helper()
+	s := &Server{tabs: make(map[string][][]string)}
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		t.Fatalf("unable to list fixtures: %v", err)
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("unable to open fixture: %v", err)
+		}
+		reader := csv.NewReader(f)
+		reader.FieldsPerRecord = -1
+		rows, err := reader.ReadAll()
+		f.Close()
+		if err != nil {
+			t.Fatalf("unable to read fixture %s: %v", file, err)
+		}
+		s.tabs[strings.TrimSuffix(filepath.Base(file), ".csv")] = rows
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Service returns a sheets client talking to this server.
+func (s *Server) Service(t testing.TB) *sheets.Service {
+	t.Helper()
+	svc, err := sheets.NewService(t.Context(), option.WithEndpoint(s.URL+"/"), option.WithHTTPClient(s.Client()))
+	if err != nil {
+		t.Fatalf("unable to create sheets service: %v", err)
+	}
+	return svc
+}
+
+// Tab returns a copy of the current content of a tab.
+func (s *Server) Tab(name string) [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := make([][]string, 0, len(s.tabs[name]))
+	for _, row := range s.tabs[name] {
+		rows = append(rows, append([]string(nil), row...))
+	}
+	return rows
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutPrefix(r.URL.Path, "/v4/spreadsheets/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	docId, rng, hasRange := strings.Cut(path, "/values/")
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/values:batchUpdate"):
+		s.batchUpdate(w, r, strings.TrimSuffix(path, "/values:batchUpdate"))
+	case !hasRange && r.Method == http.MethodGet:
+		writeJSON(w, sheets.Spreadsheet{SpreadsheetId: docId})
+	case hasRange && r.Method == http.MethodGet:
+		s.get(w, rng)
+	case hasRange && r.Method == http.MethodPost && strings.HasSuffix(rng, ":append"):
+		s.append(w, r, strings.TrimSuffix(rng, ":append"))
+	default:
+		http.Error(w, fmt.Sprintf("%s %s is not supported by the fake", r.Method, r.URL.Path), http.StatusNotImplemented)
+	}
+}
+
+func (s *Server) get(w http.ResponseWriter, rng string) {
+	a1, err := parseRange(rng)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows, ok := s.tabs[a1.tab]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unable to parse range: %s", rng), http.StatusBadRequest)
+		return
+	}
+
+	values := make([][]interface{}, 0)
+	for i, row := range rows {
+		if i < a1.fromRow || (a1.toRow >= 0 && i > a1.toRow) {
+			continue
+		}
+		cells := make([]interface{}, 0)
+		for j, cell := range row {
+			if j >= a1.fromCol && (a1.toCol < 0 || j <= a1.toCol) {
+				cells = append(cells, cell)
+			}
+		}
+		values = append(values, trim(cells))
+	}
+	writeJSON(w, sheets.ValueRange{Range: rng, MajorDimension: "ROWS", Values: values})
+}
+
+func (s *Server) append(w http.ResponseWriter, r *http.Request, rng string) {
+	a1, err := parseRange(rng)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var body sheets.ValueRange
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tabs[a1.tab]; !ok {
+		http.Error(w, fmt.Sprintf("unable to parse range: %s", rng), http.StatusBadRequest)
+		return
+	}
+	for _, values := range body.Values {
+		row := make([]string, a1.fromCol, a1.fromCol+len(values))
+		for _, value := range values {
+			row = append(row, format(value))
+		}
+		s.tabs[a1.tab] = append(s.tabs[a1.tab], row)
+	}
+	writeJSON(w, sheets.AppendValuesResponse{
+		SpreadsheetId: strings.Split(r.URL.Path, "/")[3],
+		Updates:       &sheets.UpdateValuesResponse{UpdatedRange: rng, UpdatedRows: int64(len(body.Values))},
+	})
+}
+
+func (s *Server) batchUpdate(w http.ResponseWriter, r *http.Request, docId string) {
+	var body sheets.BatchUpdateValuesRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, data := range body.Data {
+		a1, err := parseRange(data.Range)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := s.tabs[a1.tab]; !ok {
+			http.Error(w, fmt.Sprintf("unable to parse range: %s", data.Range), http.StatusBadRequest)
+			return
+		}
+		for i, values := range data.Values {
+			rowIndex := a1.fromRow + i
+			for len(s.tabs[a1.tab]) <= rowIndex {
+				s.tabs[a1.tab] = append(s.tabs[a1.tab], []string{})
+			}
+			row := s.tabs[a1.tab][rowIndex]
+			for j, value := range values {
+				for len(row) <= a1.fromCol+j {
+					row = append(row, "")
+				}
+				row[a1.fromCol+j] = format(value)
+			}
+			s.tabs[a1.tab][rowIndex] = row
+		}
+	}
+	writeJSON(w, sheets.BatchUpdateValuesResponse{SpreadsheetId: docId, TotalUpdatedCells: int64(len(body.Data))})
+}
+
+// a1Range is the subset of the A1 notation the app uses: `Tab`, `Tab!A2`, `Tab!A:D`, `Tab!A1:D1`, `Tab!1:1`.
+type a1Range struct {
+	tab     string
+	fromCol int
+	toCol   int // -1 when unbounded.
+	fromRow int
+	toRow   int // -1 when unbounded.
+}
+
+func parseRange(rng string) (a1Range, error) {
+	tab, cells, ok := strings.Cut(rng, "!")
+	a1 := a1Range{tab: tab, toCol: -1, toRow: -1}
+	if !ok {
+		return a1, nil
+	}
+	from, to, bounded := strings.Cut(cells, ":")
+	var err error
+	if a1.fromCol, a1.fromRow, err = parseCell(from); err != nil {
+		return a1, fmt.Errorf("unable to parse range %s: %v", rng, err)
+	}
+	if a1.fromCol < 0 {
+		a1.fromCol = 0
+	}
+	if a1.fromRow < 0 {
+		a1.fromRow = 0
+	}
+	if bounded {
+		if a1.toCol, a1.toRow, err = parseCell(to); err != nil {
+			return a1, fmt.Errorf("unable to parse range %s: %v", rng, err)
+		}
+	}
+	return a1, nil
+}
+
+// parseCell turns `B3` into 0 based column and row indexes, either is -1 when omitted like in `B` or `3`.
+func parseCell(cell string) (col, row int, err error) {
+	letters := strings.TrimRight(cell, "0123456789")
+	digits := cell[len(letters):]
+	if letters == "" && digits == "" {
+		return 0, 0, fmt.Errorf("empty cell reference")
+	}
+	for _, c := range letters {
+		if c < 'A' || c > 'Z' {
+			return 0, 0, fmt.Errorf("invalid column in %q", cell)
+		}
+		col = col*26 + int(c-'A'+1)
+	}
+	if digits != "" {
+		if row, err = strconv.Atoi(digits); err != nil {
+			return 0, 0, err
+		}
+	}
+	return col - 1, row - 1, nil
+}
+
+// format renders a value the way Sheets displays it once entered.
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// trim drops trailing empty cells like the real API does.
+func trim(cells []interface{}) []interface{} {
+	for len(cells) > 0 && cells[len(cells)-1] == "" {
+		cells = cells[:len(cells)-1]
+	}
+	return cells
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
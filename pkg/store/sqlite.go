@@ -0,0 +1,518 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+// migrations are applied in order, PRAGMA user_version records how many already ran.
+// Never edit an existing entry, append a new one instead.
+var migrations = []string{
+	`CREATE TABLE people (
+		name      TEXT PRIMARY KEY,
+		birthdate TEXT NOT NULL, -- 2006-01-02
+		weight    INTEGER NOT NULL DEFAULT 0,
+		photo     TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE medicines (
+		name           TEXT NOT NULL,
+		minimum_weight INTEGER NOT NULL DEFAULT 0,
+		minimum_age    TEXT NOT NULL DEFAULT '0', -- Durations use the same notation as the sheet, eg. 6h, 3d, 2y.
+		dose           TEXT NOT NULL DEFAULT '',
+		dose_interval  TEXT NOT NULL DEFAULT '0',
+		max_doses      INTEGER NOT NULL DEFAULT 0,
+		interval       TEXT NOT NULL DEFAULT '0'
+	);
+	CREATE TABLE events (
+		person   TEXT NOT NULL,
+		medicine TEXT NOT NULL,
+		at       TEXT NOT NULL -- 2006-01-02 15:04:05 in UTC
+	);`,
+	`ALTER TABLE events ADD COLUMN override INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE events ADD COLUMN override_reason TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE events ADD COLUMN id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE events ADD COLUMN deleted_at TEXT NOT NULL DEFAULT '';
+	ALTER TABLE events ADD COLUMN deleted_by TEXT NOT NULL DEFAULT '';
+	CREATE TABLE audit (
+		at      TEXT NOT NULL,
+		who     TEXT NOT NULL,
+		action  TEXT NOT NULL,
+		details TEXT NOT NULL
+	);`,
+	`ALTER TABLE medicines ADD COLUMN maximum_weight INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE medicines ADD COLUMN maximum_age TEXT NOT NULL DEFAULT '0';
+	ALTER TABLE medicines ADD COLUMN match TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE medicines ADD COLUMN per_kg REAL NOT NULL DEFAULT 0; -- mg/kg
+	ALTER TABLE medicines ADD COLUMN concentration REAL NOT NULL DEFAULT 0; -- mg/mL
+	ALTER TABLE medicines ADD COLUMN max_single_dose REAL NOT NULL DEFAULT 0; -- mg
+	ALTER TABLE medicines ADD COLUMN graduation REAL NOT NULL DEFAULT 0; -- mL`,
+	`CREATE TABLE weights (
+		person TEXT NOT NULL,
+		date   TEXT NOT NULL, -- 2006-01-02
+		value  REAL NOT NULL,
+		unit   TEXT NOT NULL DEFAULT ''
+	);`,
+	`ALTER TABLE medicines ADD COLUMN ingredient TEXT NOT NULL DEFAULT '';
+	ALTER TABLE medicines ADD COLUMN strength REAL NOT NULL DEFAULT 0; -- mg
+	ALTER TABLE medicines ADD COLUMN max_daily REAL NOT NULL DEFAULT 0; -- mg
+	ALTER TABLE medicines ADD COLUMN max_daily_per_kg REAL NOT NULL DEFAULT 0; -- mg/kg`,
+	`CREATE TABLE interactions (
+		medicine TEXT NOT NULL, -- A medicine or an active ingredient.
+		other    TEXT NOT NULL,
+		within   TEXT NOT NULL,
+		note     TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE contraindications (
+		person   TEXT NOT NULL,
+		medicine TEXT NOT NULL, -- A medicine or an active ingredient.
+		reason   TEXT NOT NULL DEFAULT ''
+	);`,
+	`CREATE TABLE prescriptions (
+		person        TEXT NOT NULL,
+		medicine      TEXT NOT NULL,
+		dose          TEXT NOT NULL,
+		times_per_day INTEGER NOT NULL,
+		start         TEXT NOT NULL, -- 2006-01-02
+		end           TEXT NOT NULL, -- 2006-01-02, included.
+		times         TEXT NOT NULL DEFAULT '' -- eg. 08:00 14:00 20:00
+	);`,
+	`CREATE TABLE stock (
+		medicine   TEXT NOT NULL,
+		quantity   REAL NOT NULL,
+		unit       TEXT NOT NULL DEFAULT '', -- mL, mg or anything else to count the doses.
+		added      TEXT NOT NULL, -- 2006-01-02
+		expiry     TEXT NOT NULL, -- 2006-01-02
+		opened     TEXT NOT NULL DEFAULT '', -- 2006-01-02, defaults to the first dose.
+		shelf_life TEXT NOT NULL DEFAULT '0',
+		low_at     REAL NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE observations (
+		person      TEXT NOT NULL,
+		at          TEXT NOT NULL, -- 2006-01-02 15:04:05 in UTC
+		temperature REAL NOT NULL DEFAULT 0, -- °C, 0 when it wasn't taken.
+		symptoms    TEXT NOT NULL DEFAULT '',
+		medicine    TEXT NOT NULL DEFAULT ''
+	);`,
+	`ALTER TABLE events ADD COLUMN given_by TEXT NOT NULL DEFAULT '';`,
+}
+
+// SQLite keeps the data in a local database whose tables mirror the tabs of the Google Sheet.
+type SQLite struct {
+	DB *sql.DB
+	// Location is the time zone of the household, the times are stored in UTC and read in it.
+	Location *time.Location
+}
+
+var _ Store = (*SQLite)(nil)
+
+func NewSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database %s: %v", path, err)
+	}
+	// SQLite only supports a single writer, this avoids "database is locked" errors.
+	db.SetMaxOpenConns(1)
+	s := &SQLite{DB: db, Location: time.Local}
+	if err := s.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLite) migrate(ctx context.Context) error {
+	var version int
+	if err := s.DB.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("unable to read schema version: %v", err)
+	}
+	for ; version < len(migrations); version++ {
+		slog.Info("applying migration", "version", version+1)
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("unable to start migration %d: %v", version+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to apply migration %d: %v", version+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to record migration %d: %v", version+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("unable to commit migration %d: %v", version+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) Close() error {
+	return s.DB.Close()
+}
+
+func (s *SQLite) getPeople(ctx context.Context) (models.PeopleSlice, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT name, birthdate, weight, photo FROM people ORDER BY rowid")
+	if err != nil {
+		return nil, fmt.Errorf("unable to query people: %v", err)
+	}
+	defer rows.Close()
+
+	people := make(models.PeopleSlice, 0)
+	for rows.Next() {
+		var person models.PersonCfg
+		var birth string
+		if err := rows.Scan(&person.Name, &birth, &person.Weight, &person.PhotoUrl); err != nil {
+			return nil, fmt.Errorf("unable to read person: %v", err)
+		}
+		if person.Birth, err = time.Parse(time.DateOnly, birth); err != nil {
+			return nil, fmt.Errorf("unable to parse birthdate of %s: %v", person.Name, err)
+		}
+		people = append(people, person)
+	}
+	return people, rows.Err()
+}
+
+func (s *SQLite) getWeights(ctx context.Context) ([]models.WeightMeasurement, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT person, date, value, unit FROM weights ORDER BY rowid")
+	if err != nil {
+		return nil, fmt.Errorf("unable to query weights: %v", err)
+	}
+	defer rows.Close()
+
+	weights := make([]models.WeightMeasurement, 0)
+	for rows.Next() {
+		var measurement models.WeightMeasurement
+		var date string
+		if err := rows.Scan(&measurement.Who, &date, &measurement.Value, &measurement.Unit); err != nil {
+			return nil, fmt.Errorf("unable to read weight: %v", err)
+		}
+		if measurement.When, err = time.Parse(time.DateOnly, date); err != nil {
+			return nil, fmt.Errorf("unable to parse the date of a weight of %s: %v", measurement.Who, err)
+		}
+		weights = append(weights, measurement)
+	}
+	return weights, rows.Err()
+}
+
+func (s *SQLite) getInteractions(ctx context.Context) ([]models.Interaction, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT medicine, other, within, note FROM interactions ORDER BY rowid")
+	if err != nil {
+		return nil, fmt.Errorf("unable to query interactions: %v", err)
+	}
+	defer rows.Close()
+
+	interactions := make([]models.Interaction, 0)
+	for rows.Next() {
+		var interaction models.Interaction
+		var within string
+		if err := rows.Scan(&interaction.Medicine, &interaction.Other, &within, &interaction.Note); err != nil {
+			return nil, fmt.Errorf("unable to read interaction: %v", err)
+		}
+		if interaction.Within, err = models.ParseDuration(within); err != nil {
+			return nil, fmt.Errorf("unable to parse the interaction of %s and %s: %v", interaction.Medicine, interaction.Other, err)
+		}
+		interactions = append(interactions, interaction)
+	}
+	return interactions, rows.Err()
+}
+
+func (s *SQLite) getContraindications(ctx context.Context) ([]models.Contraindication, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT person, medicine, reason FROM contraindications ORDER BY rowid")
+	if err != nil {
+		return nil, fmt.Errorf("unable to query contraindications: %v", err)
+	}
+	defer rows.Close()
+
+	contraindications := make([]models.Contraindication, 0)
+	for rows.Next() {
+		var contraindication models.Contraindication
+		if err := rows.Scan(&contraindication.Who, &contraindication.What, &contraindication.Reason); err != nil {
+			return nil, fmt.Errorf("unable to read contraindication: %v", err)
+		}
+		contraindications = append(contraindications, contraindication)
+	}
+	return contraindications, rows.Err()
+}
+
+func (s *SQLite) getPrescriptions(ctx context.Context) ([]models.Prescription, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT person, medicine, dose, times_per_day, start, end, times
+		FROM prescriptions ORDER BY rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query prescriptions: %v", err)
+	}
+	defer rows.Close()
+
+	prescriptions := make([]models.Prescription, 0)
+	for rows.Next() {
+		var prescription models.Prescription
+		var start, end string
+		if err := rows.Scan(&prescription.Who, &prescription.What, &prescription.Dose, &prescription.TimesPerDay, &start, &end, &prescription.Times); err != nil {
+			return nil, fmt.Errorf("unable to read prescription: %v", err)
+		}
+		if prescription.Start, err = time.Parse(time.DateOnly, start); err != nil {
+			return nil, fmt.Errorf("unable to parse the start of a prescription of %s: %v", prescription.Who, err)
+		}
+		if prescription.End, err = time.Parse(time.DateOnly, end); err != nil {
+			return nil, fmt.Errorf("unable to parse the end of a prescription of %s: %v", prescription.Who, err)
+		}
+		if err := prescription.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid prescription of %s for %s: %v", prescription.What, prescription.Who, err)
+		}
+		prescriptions = append(prescriptions, prescription)
+	}
+	return prescriptions, rows.Err()
+}
+
+func (s *SQLite) getInventory(ctx context.Context) ([]models.StockItem, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT medicine, quantity, unit, added, expiry, opened, shelf_life, low_at
+		FROM stock ORDER BY rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query stock: %v", err)
+	}
+	defer rows.Close()
+
+	inventory := make([]models.StockItem, 0)
+	for rows.Next() {
+		var item models.StockItem
+		var added, expiry, opened, shelfLife string
+		if err := rows.Scan(&item.What, &item.Quantity, &item.Unit, &added, &expiry, &opened, &shelfLife, &item.LowAt); err != nil {
+			return nil, fmt.Errorf("unable to read stock: %v", err)
+		}
+		if item.Added, err = time.Parse(time.DateOnly, added); err != nil {
+			return nil, fmt.Errorf("unable to parse when some %s was added: %v", item.What, err)
+		}
+		if item.Expiry, err = time.Parse(time.DateOnly, expiry); err != nil {
+			return nil, fmt.Errorf("unable to parse the expiry of some %s: %v", item.What, err)
+		}
+		if opened != "" {
+			if item.Opened, err = time.Parse(time.DateOnly, opened); err != nil {
+				return nil, fmt.Errorf("unable to parse when some %s was opened: %v", item.What, err)
+			}
+		}
+		if item.ShelfLife, err = models.ParseDuration(shelfLife); err != nil {
+			return nil, fmt.Errorf("unable to parse the shelf life of some %s: %v", item.What, err)
+		}
+		if err := item.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid stock of %s added on %s: %v", item.What, added, err)
+		}
+		inventory = append(inventory, item)
+	}
+	return inventory, rows.Err()
+}
+
+func (s *SQLite) getObservations(ctx context.Context) ([]models.Observation, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT person, at, temperature, symptoms, medicine FROM observations ORDER BY rowid")
+	if err != nil {
+		return nil, fmt.Errorf("unable to query observations: %v", err)
+	}
+	defer rows.Close()
+
+	observations := make([]models.Observation, 0)
+	for rows.Next() {
+		var observation models.Observation
+		var at string
+		if err := rows.Scan(&observation.Who, &at, &observation.Temperature, &observation.Symptoms, &observation.What); err != nil {
+			return nil, fmt.Errorf("unable to read observation: %v", err)
+		}
+		if observation.When, err = models.ParseTime(at, time.DateTime, time.UTC); err != nil {
+			return nil, fmt.Errorf("unable to parse observation date: %v", err)
+		}
+		observation.When = observation.When.In(s.Location)
+		observations = append(observations, observation)
+	}
+	return observations, rows.Err()
+}
+
+func (s *SQLite) getEvents(ctx context.Context) ([]models.Dose, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, person, medicine, at, override, override_reason, given_by
+		FROM events WHERE deleted_at = '' ORDER BY rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query events: %v", err)
+	}
+	defer rows.Close()
+
+	events := make([]models.Dose, 0)
+	for rows.Next() {
+		var dose models.Dose
+		var at string
+		if err := rows.Scan(&dose.ID, &dose.Who, &dose.What, &at, &dose.Override, &dose.OverrideReason, &dose.GivenBy); err != nil {
+			return nil, fmt.Errorf("unable to read event: %v", err)
+		}
+		if dose.When, err = models.ParseTime(at, time.DateTime, time.UTC); err != nil {
+			return nil, fmt.Errorf("unable to parse event date: %v", err)
+		}
+		dose.When = dose.When.In(s.Location)
+		events = append(events, dose)
+	}
+	return events, rows.Err()
+}
+
+func (s *SQLite) getMedicines(ctx context.Context) (models.MedicinesMap, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT name, minimum_weight, minimum_age, maximum_weight, maximum_age, match, dose, dose_interval, max_doses, interval,
+			per_kg, concentration, max_single_dose, graduation,
+			ingredient, strength, max_daily, max_daily_per_kg
+		FROM medicines ORDER BY rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query medicines: %v", err)
+	}
+	defer rows.Close()
+
+	medicines := make(models.MedicinesMap)
+	for rows.Next() {
+		var name models.Medicine
+		var entry models.PosologyEntry
+		var olderThan, youngerThan, doseInterval, maxDosesInterval string
+		if err := rows.Scan(&name, &entry.HeavierThan, &olderThan, &entry.LighterThan, &youngerThan, &entry.Match, &entry.Dose, &doseInterval, &entry.MaxDoses, &maxDosesInterval,
+			&entry.PerKg, &entry.Concentration, &entry.MaxSingleDose, &entry.Graduation,
+			&entry.Ingredient, &entry.Strength, &entry.MaxDaily, &entry.MaxDailyPerKg); err != nil {
+			return nil, fmt.Errorf("unable to read medicine: %v", err)
+		}
+		for _, d := range []struct {
+			field *time.Duration
+			value string
+		}{
+			{&entry.OlderThan, olderThan},
+			{&entry.YoungerThan, youngerThan},
+			{&entry.DoseInterval, doseInterval},
+			{&entry.MaxDosesInterval, maxDosesInterval},
+		} {
+			if *d.field, err = models.ParseDuration(d.value); err != nil {
+				return nil, fmt.Errorf("unable to parse posology of %s: %v", name, err)
+			}
+		}
+		if err := entry.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid posology for %s: %v", name, err)
+		}
+		if _, ok := medicines[name]; !ok {
+			medicines[name] = &models.MedicineCfg{Posology: make([]models.PosologyEntry, 0)}
+		}
+		medicines[name].Posology = append(medicines[name].Posology, entry)
+	}
+	return medicines, rows.Err()
+}
+
+func (s *SQLite) Snapshot(ctx context.Context) (snapshot models.Snapshot, err error) {
+	snapshot.FetchedAt = time.Now()
+	if snapshot.People, err = s.getPeople(ctx); err != nil {
+		return snapshot, fmt.Errorf("unable to retrieve people: %v", err)
+	}
+	if snapshot.Medicines, err = s.getMedicines(ctx); err != nil {
+		return snapshot, fmt.Errorf("unable to retrieve medicines: %v", err)
+	}
+	events, err := s.getEvents(ctx)
+	if err != nil {
+		return snapshot, fmt.Errorf("unable to retrieve doses: %v", err)
+	}
+	snapshot.Doses = make(models.DosesMap)
+	for _, dose := range events {
+		snapshot.AddDose(dose)
+	}
+	if snapshot.Interactions, err = s.getInteractions(ctx); err != nil {
+		return snapshot, fmt.Errorf("unable to retrieve interactions: %v", err)
+	}
+	if snapshot.Contraindications, err = s.getContraindications(ctx); err != nil {
+		return snapshot, fmt.Errorf("unable to retrieve contraindications: %v", err)
+	}
+	if snapshot.Prescriptions, err = s.getPrescriptions(ctx); err != nil {
+		return snapshot, fmt.Errorf("unable to retrieve prescriptions: %v", err)
+	}
+	if snapshot.Inventory, err = s.getInventory(ctx); err != nil {
+		return snapshot, fmt.Errorf("unable to retrieve stock: %v", err)
+	}
+	if snapshot.Observations, err = s.getObservations(ctx); err != nil {
+		return snapshot, fmt.Errorf("unable to retrieve observations: %v", err)
+	}
+	weights, err := s.getWeights(ctx)
+	if err != nil {
+		return snapshot, fmt.Errorf("unable to retrieve weights: %v", err)
+	}
+	for _, measurement := range weights {
+		if err := snapshot.AddWeight(measurement); err != nil {
+			return snapshot, err
+		}
+	}
+	return snapshot, nil
+}
+
+func (s *SQLite) LogDose(ctx context.Context, dose models.Dose) error {
+	slog.Info("dose intake", "person", dose.Who, "medicine", dose.What)
+	_, err := s.DB.ExecContext(ctx,
+		"INSERT INTO events (id, person, medicine, at, override, override_reason, given_by) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		dose.ID, dose.Who, dose.What, dose.When.UTC().Format(time.DateTime), dose.Override, dose.OverrideReason, dose.GivenBy,
+	)
+	if err != nil {
+		slog.Error("unable to log dose intake", "error", err)
+		return fmt.Errorf("unable to log dose intake: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) LogWeight(ctx context.Context, measurement models.WeightMeasurement) error {
+	slog.Info("weight measurement", "person", measurement.Who, "weight", measurement.Value, "unit", measurement.Unit)
+	_, err := s.DB.ExecContext(ctx,
+		"INSERT INTO weights (person, date, value, unit) VALUES (?, ?, ?, ?)",
+		measurement.Who, measurement.When.Format(time.DateOnly), measurement.Value, measurement.Unit,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to log weight: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) LogObservation(ctx context.Context, observation models.Observation) error {
+	slog.Info("observation", "person", observation.Who, "temperature", observation.Temperature)
+	_, err := s.DB.ExecContext(ctx,
+		"INSERT INTO observations (person, at, temperature, symptoms, medicine) VALUES (?, ?, ?, ?, ?)",
+		observation.Who, observation.When.UTC().Format(time.DateTime), observation.Temperature, observation.Symptoms, observation.What,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to log observation: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteDose(ctx context.Context, key string, by string) error {
+	slog.Info("deleting dose", "key", key, "by", by)
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.DateTime)
+	// Mirrors models.Dose.Key for the doses inserted by hand without an ID.
+	res, err := tx.ExecContext(ctx, `
+		UPDATE events SET deleted_at = ?, deleted_by = ?
+		WHERE rowid = (
+			SELECT rowid FROM events
+			WHERE deleted_at = '' AND (id = ? OR (id = '' AND person || '|' || medicine || '|' || at = ?))
+			LIMIT 1
+		)`,
+		now, by, key, key,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to delete dose: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrDoseNotFound
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO audit (at, who, action, details) VALUES (?, ?, ?, ?)",
+		now, by, "delete dose", key,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to record the deletion in the audit log: %v", err)
+	}
+	return tx.Commit()
+}
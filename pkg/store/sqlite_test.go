@@ -0,0 +1,133 @@
+package store_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/nanassito/medicine/pkg/models"
+	"github.com/nanassito/medicine/pkg/store"
+)
+
+func newTestSQLite(t *testing.T) *store.SQLite {
+	t.Helper()
+	st, err := store.NewSQLite(filepath.Join(t.TempDir(), "medicine.db"))
+	if err != nil {
+		t.Fatalf("NewSQLite() error = %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	_, err = st.DB.Exec(`
+		INSERT INTO people (name, birthdate, weight, photo) VALUES ('John', '2015-06-01', 30, 'john.jpg');
+		INSERT INTO medicines (name, minimum_age, dose, dose_interval, max_doses, interval) VALUES ('Aspirin', '2y', '1 pill', '6h', 4, '1d');
+		INSERT INTO medicines (name, minimum_weight, dose, dose_interval, max_doses, interval) VALUES ('Aspirin', 50, '2 pills', '6h', 4, '1d');
+		INSERT INTO interactions (medicine, other, within) VALUES ('Ibuprofen', 'aspirin', '8h');
+		INSERT INTO contraindications (person, medicine, reason) VALUES ('John', 'Ibuprofen', 'allergic');
+		INSERT INTO prescriptions (person, medicine, dose, times_per_day, start, end, times) VALUES ('John', 'Aspirin', '1 pill', 2, '2024-01-01', '2024-01-07', '09:00 21:00');
+		INSERT INTO stock (medicine, quantity, unit, added, expiry, opened, shelf_life) VALUES ('Aspirin', 150, 'mL', '2024-01-01', '2026-01-01', '2024-01-02', '4w');
+	`)
+	if err != nil {
+		t.Fatalf("unable to seed database: %v", err)
+	}
+	return st
+}
+
+func TestSQLiteSnapshot(t *testing.T) {
+	st := newTestSQLite(t)
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := st.LogDose(context.Background(), models.Dose{Who: "John", What: "Aspirin", When: when}); err != nil {
+		t.Fatalf("LogDose() error = %v", err)
+	}
+	weighed := models.WeightMeasurement{Who: "John", When: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Value: 70, Unit: "lb"}
+	if err := st.LogWeight(context.Background(), weighed); err != nil {
+		t.Fatalf("LogWeight() error = %v", err)
+	}
+	observed := models.Observation{Who: "John", When: when, Temperature: 38.5, Symptoms: "cough", What: "Aspirin"}
+	if err := st.LogObservation(context.Background(), observed); err != nil {
+		t.Fatalf("LogObservation() error = %v", err)
+	}
+
+	got, err := st.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	want := models.Snapshot{
+		People: models.PeopleSlice{
+			{Name: "John", Birth: time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC), Weight: 30, PhotoUrl: "john.jpg"},
+		},
+		Medicines: models.MedicinesMap{
+			"Aspirin": &models.MedicineCfg{
+				Posology: []models.PosologyEntry{
+					{OlderThan: 2 * 365 * 24 * time.Hour, Dose: "1 pill", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour},
+					{HeavierThan: 50, Dose: "2 pills", DoseInterval: 6 * time.Hour, MaxDoses: 4, MaxDosesInterval: 24 * time.Hour},
+				},
+			},
+		},
+		Doses: models.DosesMap{
+			"John": {"Aspirin": {when}},
+		},
+		Events: []models.Dose{
+			{Who: "John", What: "Aspirin", When: when},
+		},
+		Weights:           []models.WeightMeasurement{weighed},
+		Interactions:      []models.Interaction{{Medicine: "Ibuprofen", Other: "aspirin", Within: 8 * time.Hour}},
+		Contraindications: []models.Contraindication{{Who: "John", What: "Ibuprofen", Reason: "allergic"}},
+		Prescriptions: []models.Prescription{
+			{Who: "John", What: "Aspirin", Dose: "1 pill", TimesPerDay: 2, Start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), Times: "09:00 21:00"},
+		},
+		Inventory: []models.StockItem{
+			{What: "Aspirin", Quantity: 150, Unit: "mL", Added: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Expiry: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Opened: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), ShelfLife: 4 * 7 * 24 * time.Hour},
+		},
+		Observations: []models.Observation{observed},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(models.Snapshot{}, "FetchedAt")); diff != "" {
+		t.Errorf("Snapshot() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSQLiteMigrationsAreIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "medicine.db")
+	for range 2 {
+		st, err := store.NewSQLite(path)
+		if err != nil {
+			t.Fatalf("NewSQLite() error = %v", err)
+		}
+		st.Close()
+	}
+}
+
+func TestSQLiteDeleteDose(t *testing.T) {
+	ctx := context.Background()
+	st := newTestSQLite(t)
+	legacy := models.Dose{Who: "John", What: "Aspirin", When: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	logged := models.Dose{ID: "abc", Who: "John", What: "Aspirin", When: time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC)}
+	for _, dose := range []models.Dose{legacy, logged} {
+		if err := st.LogDose(ctx, dose); err != nil {
+			t.Fatalf("LogDose() error = %v", err)
+		}
+	}
+
+	for _, key := range []string{legacy.Key(), logged.Key()} {
+		if err := st.DeleteDose(ctx, key, "Jane"); err != nil {
+			t.Fatalf("DeleteDose(%s) error = %v", key, err)
+		}
+		if err := st.DeleteDose(ctx, key, "Jane"); err != store.ErrDoseNotFound {
+			t.Errorf("DeleteDose(%s) twice error = %v, want %v", key, err, store.ErrDoseNotFound)
+		}
+	}
+
+	snapshot, err := st.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if len(snapshot.Events) != 0 || len(snapshot.Doses) != 0 {
+		t.Errorf("Snapshot() still has doses %v", snapshot.Events)
+	}
+	var audited int
+	if err := st.DB.QueryRow("SELECT COUNT(*) FROM audit WHERE who = 'Jane'").Scan(&audited); err != nil || audited != 2 {
+		t.Errorf("audit has %d entries for Jane (error %v), want 2", audited, err)
+	}
+}
@@ -0,0 +1,24 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nanassito/medicine/pkg/models"
+)
+
+// Store is where the people, medicines and dose events are kept.
+type Store interface {
+	// Snapshot loads everything needed to evaluate whether someone can take a medicine.
+	Snapshot(ctx context.Context) (models.Snapshot, error)
+	// LogDose records that a dose was taken.
+	LogDose(ctx context.Context, dose models.Dose) error
+	// DeleteDose tombstones the dose with that key and records who did it in the audit log.
+	DeleteDose(ctx context.Context, key string, by string) error
+	// LogWeight adds a measurement to the weight history of someone.
+	LogWeight(ctx context.Context, measurement models.WeightMeasurement) error
+	// LogObservation records someone's temperature or symptoms.
+	LogObservation(ctx context.Context, observation models.Observation) error
+}
+
+var ErrDoseNotFound = errors.New("dose not found")
@@ -0,0 +1,50 @@
+package templates
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"time"
+)
+
+var funcs = template.FuncMap{
+	"ago":      ago,
+	"until":    until,
+	"quantity": quantity,
+}
+
+// ago formats how long ago something happened, coarser as it gets older.
+func ago(t time.Time) string {
+	elapsed := time.Since(t)
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%dm ago", int(elapsed.Minutes()))
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf("%dh%02dm ago", int(elapsed.Hours()), int(elapsed.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd%02dh ago", int(elapsed.Hours())/24, int(elapsed.Hours())%24)
+	}
+}
+
+// until formats how long until something happens, the same way as ago.
+func until(t time.Time) string {
+	remaining := time.Until(t)
+	switch {
+	case remaining < time.Minute:
+		return "now"
+	case remaining < time.Hour:
+		return fmt.Sprintf("in %dm", int(remaining.Minutes()))
+	case remaining < 24*time.Hour:
+		return fmt.Sprintf("in %dh%02dm", int(remaining.Hours()), int(remaining.Minutes())%60)
+	default:
+		return fmt.Sprintf("in %dd%02dh", int(remaining.Hours())/24, int(remaining.Hours())%24)
+	}
+}
+
+// quantity formats what is left of a stock item without the float noise, eg. 12.3 rather than 12.299999.
+func quantity(q float64) string {
+	return strconv.FormatFloat(math.Round(q*100)/100, 'f', -1, 64)
+}
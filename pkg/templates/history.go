@@ -0,0 +1,81 @@
+package templates
+
+import (
+	"html/template"
+)
+
+var History = template.Must(template.New("History").Funcs(funcs).Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>{{.Title}}</title>
+	<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/purecss@3.0.0/build/pure-min.css" integrity="sha384-X38yfunGUhNzHpBaEBsWLO+A0HDYOQi8ufWDkZ0k9e0eXz/tH3II7uKZ9msv++Ls" crossorigin="anonymous">
+</head>
+<body>
+	<h1>{{.Title}}</h1>
+	<img class="pure-img" src="{{.Who.PhotoUrl}}" alt="{{.Who.Name}}">
+	{{if not .MedicineName}}<p><a class="pure-button" href="/people/{{.Who.Name}}/plan">Plan alternating medicines</a> <a class="pure-button" href="/people/{{.Who.Name}}/prescriptions">Prescriptions</a> <a class="pure-button" href="/people/{{.Who.Name}}/observations">Temperature</a></p>{{end}}
+	{{if .Records}}
+	<table class="pure-table pure-table-horizontal" style="width: 100%">
+		<thead>
+			<tr>
+				<th>When</th>
+				{{if not .MedicineName}}<th>Medicine</th>{{end}}
+				<th>Posology</th>
+				<th>Interval</th>
+				<th>Max doses</th>
+				<th></th>
+			</tr>
+		</thead>
+		{{range .Records}}
+		<tr{{if not .Respected}} style="background-color: #FDE2DE;"{{end}}>
+			<td title="{{.When.Format "2006-01-02 15:04:05"}}">{{ago .When}}{{with .GivenBy}} by {{.}}{{end}}{{if .Override}} <em>(override: {{.OverrideReason}})</em>{{end}}{{if .Violation}}<br><strong>{{.Violation}}</strong>{{end}}</td>
+			{{if not $.MedicineName}}<td><a href="/{{.What}}/{{.Who}}/history">{{.What}}</a></td>{{end}}
+			{{if .PosologyError}}
+			<td colspan="3">{{.PosologyError}}</td>
+			{{else}}
+			<td>{{.Posology.Dose}} every {{.Posology.DoseInterval}}, at most {{.Posology.MaxDoses}} over {{.Posology.MaxDosesInterval}}</td>
+			<td>{{if .TooSoon}}too soon{{else}}ok{{end}}</td>
+			<td>{{if .TooMany}}too many{{else if .TooMuch}}too much {{.Posology.Ingredient}}{{else}}ok{{end}}</td>
+			{{end}}
+			<td>
+				<form method="post" action="/doses/delete" onsubmit="return confirm('Delete this dose?');">
+					<input type="hidden" name="csrf" value="{{$.CSRF}}">
+					<input type="hidden" name="key" value="{{.Key}}">
+					<input type="hidden" name="next" value="{{$.Path}}">
+					<button type="submit" class="pure-button">Delete</button>
+				</form>
+			</td>
+		</tr>
+		{{end}}
+	</table>
+	{{else}}
+	<p>No dose recorded yet.</p>
+	{{end}}
+	{{if not .MedicineName}}
+	<h3>Weight</h3>
+	<form method="post" action="/people/{{.Who.Name}}/weight" class="pure-form">
+		<input type="hidden" name="csrf" value="{{.CSRF}}">
+		<input type="number" name="weight" step="0.01" min="0" placeholder="Weight" required>
+		<select name="unit">
+			<option value="kg">kg</option>
+			<option value="g">g</option>
+			<option value="lb">lb</option>
+		</select>
+		<input type="date" name="date">
+		<button type="submit" class="pure-button pure-button-primary">Log</button>
+	</form>
+	{{if .Weights}}
+	<table class="pure-table pure-table-horizontal" style="width: 100%">
+		{{range .Weights}}
+		<tr><td>{{.When.Format "2006-01-02"}}</td><td>{{.Value}} {{or .Unit "kg"}}</td></tr>
+		{{end}}
+	</table>
+	{{end}}
+	{{end}}
+	<p style="color: #999; font-size: 0.8rem;">Data from {{.Age}} ago</p>
+</body>
+</html>
+`))
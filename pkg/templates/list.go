@@ -4,7 +4,7 @@ import (
 	"html/template"
 )
 
-var List = template.Must(template.New("List").Funcs(template.FuncMap{}).Parse(`
+var List = template.Must(template.New("List").Funcs(funcs).Parse(`
 <!DOCTYPE html>
 <html>
 <head>
@@ -31,15 +31,39 @@ var List = template.Must(template.New("List").Funcs(template.FuncMap{}).Parse(`
 			border-color: #999;
 			box-shadow: 0 2px 8px rgba(0,0,0,0.1);
 		}
+		.stock-alert {
+			float: right;
+			padding: 0 0.5rem;
+			border-radius: 4px;
+			background: #ca3c3c;
+			color: white;
+			font-size: 0.9rem;
+		}
+		.stock { display: block; color: #777; font-size: 0.8rem; }
 	</style>
 </head>
 <body>
 	<h1>All Medicines</h1>
 	<div class="medicine-cards">
 		{{ range .Medicines }}
-		<a class="medicine-card" href="./{{.}}">{{.}}</a>
+		<a class="medicine-card" href="./{{.Name}}">{{.Name}}
+			{{ with .Stock }}{{ if .Tracked }}
+			{{ if .Expired }}<span class="stock-alert">Expired</span>{{ end }}
+			{{ if .Empty }}<span class="stock-alert">Out of stock</span>{{ else if .Low }}<span class="stock-alert">Low stock</span>{{ end }}
+			{{ if .Uncounted }}<span class="stock-alert" title="The posology doesn't tell how much of it a dose takes">Untracked</span>{{ end }}
+			{{ range .Levels }}
+			<span class="stock">{{quantity .Remaining}} {{.Item.Unit}} left, {{ if .Expired }}expired on{{ else }}expires on{{ end }} {{.Expires.Format "2006-01-02"}}</span>
+			{{ end }}
+			{{ end }}{{ end }}
+		</a>
 		{{ end }}
 	</div>
+	{{with .User}}
+	<form method="post" action="/logout" class="pure-form">
+		Logged in as {{.}} <button type="submit" class="pure-button">Logout</button>
+	</form>
+	{{end}}
+	<p style="color: #999; font-size: 0.8rem;">Data from {{.Age}} ago</p>
 </body>
 </html>
 `))
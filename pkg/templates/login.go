@@ -0,0 +1,27 @@
+package templates
+
+import (
+	"html/template"
+)
+
+var Login = template.Must(template.New("Login").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Login</title>
+	<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/purecss@3.0.0/build/pure-min.css" integrity="sha384-X38yfunGUhNzHpBaEBsWLO+A0HDYOQi8ufWDkZ0k9e0eXz/tH3II7uKZ9msv++Ls" crossorigin="anonymous">
+</head>
+<body>
+	<h1>Login</h1>
+	{{if .Error}}<p style="padding: 10px; background-color: #F4442E;">{{.Error}}</p>{{end}}
+	<form method="post" action="/login" class="pure-form pure-form-stacked">
+		<input type="hidden" name="next" value="{{.Next}}">
+		<input type="text" name="name" placeholder="Name" autocomplete="username" required>
+		<input type="password" name="password" placeholder="Password" autocomplete="current-password" required>
+		<button type="submit" class="pure-button pure-button-primary">Login</button>
+	</form>
+</body>
+</html>
+`))
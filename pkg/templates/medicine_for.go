@@ -4,7 +4,7 @@ import (
 	"html/template"
 )
 
-var MedicineFor = template.Must(template.New("MedicineFor").Funcs(template.FuncMap{}).Parse(`
+var MedicineFor = template.Must(template.New("MedicineFor").Funcs(funcs).Parse(`
 <!DOCTYPE html>
 <html>
 <head>
@@ -18,14 +18,78 @@ var MedicineFor = template.Must(template.New("MedicineFor").Funcs(template.FuncM
 	<img class="pure-img" src="{{.Who.PhotoUrl}}" alt="{{.Who.Name}}">
 	<div style="text-align:center; padding-top:10px; padding-bottom:10px; background-color:{{if .CanTake}}#60A561{{else if lt .WaitForPct 0.1}}#FFB400{{else}}#F4442E{{end}};">
 		<p>{{.Reason}}</p>
-		{{if .CanTake}}{{else}}<p>Do NOT take for another {{.WaitFor}}</p>{{end}}
+		{{if .CanTake}}{{else if .WaitFor}}<p>Do NOT take for another {{.WaitFor}}</p>{{end}}
 	</div>
+	{{if .StaleWeight}}
+	<div style="padding: 10px; margin-top: 10px; background-color: #FFB400;">
+		{{if .WeighedAt.IsZero}}{{.Who.Name}}'s weight of {{.Weight}}kg was never measured{{else}}{{.Who.Name}} was last weighed {{ago .WeighedAt}} at {{.Weight}}kg{{end}},
+		the posology may not fit anymore. <a href="/people/{{.Who.Name}}">Log a new weight</a>.
+	</div>
+	{{end}}
 	<h3>Posology</h3>
 	<ul>
 		<li>Dose: {{.Posology.Dose}} every {{.Posology.DoseInterval}}</li>
+		{{with .WeightDose}}
+		<li>
+			For {{.Weight}}kg: <strong>{{if .Volume}}{{.Volume}} mL ({{.Amount}} mg){{else}}{{.Amount}} mg{{end}}</strong>
+			at {{$.Posology.PerKg}} mg/kg{{if $.Posology.Concentration}} of a {{$.Posology.Concentration}} mg/mL product{{end}}
+			{{if .Capped}}<em>(capped to the maximum single dose of {{$.Posology.MaxSingleDose}} mg)</em>{{end}}
+		</li>
+		{{end}}
 		<li>No more than {{.Posology.MaxDoses}} times over {{.Posology.MaxDosesInterval}}</li>
+		{{if .DailyMax}}<li>No more than {{.DailyMax}} mg of {{.Posology.Ingredient}} over 24h, all products included</li>{{end}}
 	</ul>
-	<a style="width: 100%" class="pure-button pure-button-primary" href="/{{.MedicineName}}/{{.Who.Name}}/take"><h2>Take</h2></a>
+	{{if .Blocked}}
+	<button style="width: 100%" type="button" class="pure-button pure-button-disabled" disabled><h2>Blocked</h2></button>
+	{{else}}
+	<form method="post" action="/{{.MedicineName}}/{{.Who.Name}}/take" class="pure-form" onsubmit="this.querySelector('button').disabled = true;">
+		<input type="hidden" name="csrf" value="{{.CSRF}}">
+		<input type="hidden" name="idempotency_key" value="{{.IdempotencyKey}}">
+		<p>
+			<label for="ago">Given</label>
+			<select id="ago" name="ago">
+				<option value="">now</option>
+				<option value="15m">15 min ago</option>
+				<option value="30m">30 min ago</option>
+				<option value="1h">1 h ago</option>
+				<option value="2h">2 h ago</option>
+				<option value="4h">4 h ago</option>
+			</select>
+			<label for="when">or at</label>
+			<input type="datetime-local" id="when" name="when" max="{{.Now}}">
+		</p>
+		<button style="width: 100%" type="submit" class="pure-button pure-button-primary"><h2>Take</h2></button>
+	</form>
+	{{end}}
+	<h3>How are they?</h3>
+	<form method="post" action="/people/{{.Who.Name}}/observations" class="pure-form">
+		<input type="hidden" name="csrf" value="{{.CSRF}}">
+		<input type="hidden" name="medicine" value="{{.MedicineName}}">
+		<input type="hidden" name="next" value="/{{.MedicineName}}/{{.Who.Name}}">
+		<input type="number" name="temperature" step="0.1" min="30" max="45" placeholder="°C">
+		<input type="text" name="symptoms" placeholder="Symptoms">
+		<button type="submit" class="pure-button">Log</button>
+	</form>
+	{{if .RecentDoses}}
+	<h3>Recent doses</h3>
+	<table class="pure-table pure-table-horizontal" style="width: 100%">
+		{{range .RecentDoses}}
+		<tr>
+			<td>{{.When.Format "Mon 02 Jan 15:04"}}{{with .GivenBy}} by {{.}}{{end}}{{if .Override}} <em>(override: {{.OverrideReason}})</em>{{end}}</td>
+			<td>
+				<form method="post" action="/doses/delete" onsubmit="return confirm('Delete this dose?');">
+					<input type="hidden" name="csrf" value="{{$.CSRF}}">
+					<input type="hidden" name="key" value="{{.Key}}">
+					<input type="hidden" name="next" value="/{{$.MedicineName}}/{{$.Who.Name}}">
+					<button type="submit" class="pure-button">Delete</button>
+				</form>
+			</td>
+		</tr>
+		{{end}}
+	</table>
+	{{end}}
+	<p><a href="/{{.MedicineName}}/{{.Who.Name}}/history">Full history</a> | <a href="/people/{{.Who.Name}}/observations">Temperature chart</a></p>
+	<p style="color: #999; font-size: 0.8rem;">Data from {{.Age}} ago</p>
 </body>
 </html>
 `))
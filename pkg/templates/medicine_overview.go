@@ -15,6 +15,17 @@ var MedicineOverview = template.Must(template.New("MedicineOverview").Funcs(temp
 </head>
 <body>
 	<h1>{{.MedicineName}}</h1>
+	{{with .Logged}}
+	<div style="text-align:center; padding-top:10px; padding-bottom:10px; margin-bottom:10px; background-color:#60A561;">
+		<p>{{.What}} logged for {{.Who}}.</p>
+		<form method="post" action="/doses/delete">
+			<input type="hidden" name="csrf" value="{{$.CSRF}}">
+			<input type="hidden" name="key" value="{{.Key}}">
+			<input type="hidden" name="next" value="/{{$.MedicineName}}">
+			<button type="submit" class="pure-button">Undo</button>
+		</form>
+	</div>
+	{{end}}
 	<div class="pure-g">
 		{{ range .People }}
 			<div class="pure-u-1-2">
@@ -26,6 +37,7 @@ var MedicineOverview = template.Must(template.New("MedicineOverview").Funcs(temp
 			</div>
 		{{ end }}
 	</div>
+	<p style="color: #999; font-size: 0.8rem;">Data from {{.Age}} ago</p>
 </body>
 </html>
 `))
@@ -0,0 +1,77 @@
+package templates
+
+import (
+	"html/template"
+)
+
+var Observations = template.Must(template.New("Observations").Funcs(funcs).Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>{{.Who.Name}} - temperature</title>
+	<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/purecss@3.0.0/build/pure-min.css" integrity="sha384-X38yfunGUhNzHpBaEBsWLO+A0HDYOQi8ufWDkZ0k9e0eXz/tH3II7uKZ9msv++Ls" crossorigin="anonymous">
+</head>
+<body>
+	<h1>{{.Who.Name}} - temperature</h1>
+	<p>
+		Over the last
+		<a href="?days=1">day</a> |
+		<a href="?days=3">3 days</a> |
+		<a href="?days=7">week</a>
+	</p>
+	{{with .Chart}}
+	<svg viewBox="0 0 {{.Width}} {{.Height}}" style="width: 100%; max-width: 800px; font-family: sans-serif; font-size: 10px;">
+		{{range .Degrees}}
+		<line x1="{{$.Chart.Left}}" x2="{{$.Chart.Width}}" y1="{{.Y}}" y2="{{.Y}}" stroke="#eee"/>
+		<text x="0" y="{{.Y}}" dominant-baseline="middle">{{.Label}}</text>
+		{{end}}
+		{{range .Days}}
+		<line x1="{{.X}}" x2="{{.X}}" y1="0" y2="{{$.Chart.Bottom}}" stroke="#ccc"/>
+		<text x="{{.X}}" y="{{$.Chart.Height}}" text-anchor="middle">{{.Label}}</text>
+		{{end}}
+		<line x1="{{.Left}}" x2="{{.Width}}" y1="{{.FeverY}}" y2="{{.FeverY}}" stroke="#F4442E" stroke-dasharray="4"/>
+		{{range .Doses}}
+		<line x1="{{.X}}" x2="{{.X}}" y1="0" y2="{{$.Chart.Bottom}}" stroke="#1f8dd6" stroke-width="2"><title>{{.Label}}</title></line>
+		{{end}}
+		<polyline points="{{.Line}}" fill="none" stroke="#333" stroke-width="2"/>
+		{{range .Readings}}
+		<circle cx="{{.X}}" cy="{{.Y}}" r="4" fill="#333"><title>{{.Label}}</title></circle>
+		{{end}}
+	</svg>
+	<p style="font-size: 0.8rem;"><span style="color: #1f8dd6;">Blue lines</span> are doses, the <span style="color: #F4442E;">dashed red line</span> is a 38°C fever.</p>
+	{{end}}
+	<h3>Log an observation</h3>
+	<form method="post" action="/people/{{.Who.Name}}/observations" class="pure-form pure-form-stacked">
+		<input type="hidden" name="csrf" value="{{.CSRF}}">
+		<input type="hidden" name="next" value="/people/{{.Who.Name}}/observations">
+		<input type="number" name="temperature" step="0.1" min="30" max="45" placeholder="Temperature in °C">
+		<input type="text" name="symptoms" placeholder="Symptoms">
+		<button type="submit" class="pure-button pure-button-primary">Log</button>
+	</form>
+	{{if .Observations}}
+	<h3>Observations</h3>
+	<table class="pure-table pure-table-horizontal" style="width: 100%">
+		<thead>
+			<tr><th>When</th><th>Temperature</th><th>Symptoms</th><th>With</th></tr>
+		</thead>
+		<tbody>
+			{{range .Observations}}
+			<tr>
+				<td>{{.When.Format "Mon 02 Jan 15:04"}}</td>
+				<td>{{if .Temperature}}{{.Temperature}}°C{{end}}</td>
+				<td>{{.Symptoms}}</td>
+				<td>{{.What}}</td>
+			</tr>
+			{{end}}
+		</tbody>
+	</table>
+	{{else}}
+	<p>No observation over that period.</p>
+	{{end}}
+	<p><a href="/people/{{.Who.Name}}">History</a></p>
+	<p style="color: #999; font-size: 0.8rem;">Data from {{.Age}} ago</p>
+</body>
+</html>
+`))
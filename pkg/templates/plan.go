@@ -0,0 +1,54 @@
+package templates
+
+import (
+	"html/template"
+)
+
+var Plan = template.Must(template.New("Plan").Funcs(funcs).Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>{{.Who.Name}} - plan</title>
+	<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/purecss@3.0.0/build/pure-min.css" integrity="sha384-X38yfunGUhNzHpBaEBsWLO+A0HDYOQi8ufWDkZ0k9e0eXz/tH3II7uKZ9msv++Ls" crossorigin="anonymous">
+</head>
+<body>
+	<h1>{{.Who.Name}} - plan</h1>
+	<form method="get" class="pure-form">
+		{{range .Medicines}}
+		<label class="pure-checkbox"><input type="checkbox" name="medicine" value="{{.Name}}"{{if .Selected}} checked{{end}}> {{.Name}}</label>
+		{{end}}
+		<button type="submit" class="pure-button pure-button-primary">Plan</button>
+	</form>
+	{{if .Statuses}}
+	<h3>Now</h3>
+	<table class="pure-table pure-table-horizontal" style="width: 100%">
+		{{range .Statuses}}
+		<tr style="background-color: {{if .CanTake}}#60A561{{else}}#F4442E{{end}};">
+			<td><a href="/{{.Medicine}}/{{$.Who.Name}}">{{.Medicine}}</a></td>
+			<td>{{.Reason}}</td>
+			<td>{{if .CanTake}}allowed now{{else if .NextAt.IsZero}}not allowed{{else}}allowed {{until .NextAt}} ({{.NextAt.Format "Mon 15:04"}}){{end}}</td>
+		</tr>
+		{{end}}
+	</table>
+	<h3>Next 24 hours</h3>
+	{{if .Timeline}}
+	<table class="pure-table pure-table-horizontal" style="width: 100%">
+		{{range .Timeline}}
+		<tr>
+			<td>{{.At.Format "Mon 15:04"}}</td>
+			<td>{{until .At}}</td>
+			<td>{{.Medicine}}</td>
+			<td>{{.Dose}}</td>
+		</tr>
+		{{end}}
+	</table>
+	{{else}}
+	<p>None of them can be given over the next 24 hours.</p>
+	{{end}}
+	{{end}}
+	<p style="color: #999; font-size: 0.8rem;">Data from {{.Age}} ago</p>
+</body>
+</html>
+`))
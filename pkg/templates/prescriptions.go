@@ -0,0 +1,48 @@
+package templates
+
+import (
+	"html/template"
+)
+
+var Prescriptions = template.Must(template.New("Prescriptions").Funcs(funcs).Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>{{.Who.Name}} - prescriptions</title>
+	<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/purecss@3.0.0/build/pure-min.css" integrity="sha384-X38yfunGUhNzHpBaEBsWLO+A0HDYOQi8ufWDkZ0k9e0eXz/tH3II7uKZ9msv++Ls" crossorigin="anonymous">
+	<style>
+		.taken { background-color: #60A561; }
+		.missed { background-color: #F4442E; }
+		.due { background-color: #FFB400; }
+		.upcoming { background-color: #f0f0f0; }
+	</style>
+</head>
+<body>
+	<h1>{{.Who.Name}} - prescriptions</h1>
+	{{range .Prescriptions}}
+	<h3><a href="/{{.Prescription.What}}/{{.Prescription.Who}}">{{.Prescription.What}}</a></h3>
+	<p>
+		{{.Prescription.Dose}}, {{.Prescription.TimesPerDay}} times a day
+		from {{.Prescription.Start.Format "Mon 02 Jan"}} to {{.Prescription.End.Format "Mon 02 Jan"}}.
+	</p>
+	<p>Taken {{.Taken}} of {{.Total}} ({{.Percent}}%){{if .Missed}}, <strong>missed {{.Missed}}</strong>{{end}}.</p>
+	<progress max="{{.Total}}" value="{{.Taken}}" style="width: 100%"></progress>
+	<table class="pure-table" style="width: 100%">
+		{{range .Days}}
+		<tr>
+			<td>{{.Date.Format "Mon 02 Jan"}}</td>
+			{{range .Doses}}
+			<td class="{{.Status}}" title="{{.Status}}">{{.At.Format "15:04"}}{{with .Taken}} ({{.When.Format "15:04"}}){{end}}</td>
+			{{end}}
+		</tr>
+		{{end}}
+	</table>
+	{{else}}
+	<p>No prescription.</p>
+	{{end}}
+	<p style="color: #999; font-size: 0.8rem;">Data from {{.Age}} ago</p>
+</body>
+</html>
+`))
@@ -0,0 +1,43 @@
+package templates
+
+import (
+	"html/template"
+)
+
+var Refused = template.Must(template.New("Refused").Funcs(template.FuncMap{}).Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>{{.MedicineName}}</title>
+	<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/purecss@3.0.0/build/pure-min.css" integrity="sha384-X38yfunGUhNzHpBaEBsWLO+A0HDYOQi8ufWDkZ0k9e0eXz/tH3II7uKZ9msv++Ls" crossorigin="anonymous">
+</head>
+<body>
+	<h1>{{.MedicineName}} - {{.Who.Name}}</h1>
+	<div style="text-align:center; padding-top:10px; padding-bottom:10px; background-color:#F4442E;">
+		<h2>Do NOT take this!</h2>
+		<p>{{.Reason}}</p>
+		{{if .WaitFor}}<p>Wait for another {{.WaitFor}}</p>{{end}}
+		{{with .GivenAt}}<p>For a dose given on {{.}}.</p>{{end}}
+		<p>The dose was not recorded.</p>
+	</div>
+	<a style="width: 100%" class="pure-button" href="/{{.MedicineName}}/{{.Who.Name}}"><h2>Back</h2></a>
+	{{if .Blocked}}
+	<p>This is forbidden by an interaction or contraindication rule, it can't be given anyway.</p>
+	{{else}}
+	<h3>Give it anyway</h3>
+	<form class="pure-form pure-form-stacked" method="post" action="/{{.MedicineName}}/{{.Who.Name}}/take">
+		<input type="hidden" name="csrf" value="{{.CSRF}}">
+		<input type="hidden" name="idempotency_key" value="{{.IdempotencyKey}}">
+		<input type="hidden" name="override" value="1">
+		{{with .GivenAt}}<input type="hidden" name="when" value="{{.}}">{{end}}
+		<label for="reason">Why is it ok to give it anyway?</label>
+		<input style="width: 100%" id="reason" name="reason" type="text" placeholder="eg. the doctor said so" required>
+		{{if .MissingReason}}<span class="pure-form-message" style="color: #F4442E;">A reason is required to give it anyway.</span>{{end}}
+		<button style="width: 100%; margin-top: 1rem;" type="submit" class="pure-button">I understand, record the dose</button>
+	</form>
+	{{end}}
+</body>
+</html>
+`))